@@ -2,18 +2,38 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 )
 
 // AlertRuleSpec defines the desired state of AlertRule
 type AlertRuleSpec struct {
-	// Groups is a list of alert groups
-	Groups []AlertGroup `json:"groups"`
+	// Groups is a list of alert groups. Strategic merge patches merge groups by name.
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	Groups []AlertGroup `json:"groups" patchStrategy:"merge" patchMergeKey:"name"`
 
 	// Labels to add to the generated PrometheusRule
 	// +optional
 	Labels map[string]string `json:"labels,omitempty"`
+
+	// DriftPolicy controls what happens when the generated PrometheusRule is changed
+	// outside the operator. Revert restores the generated rules, Report only records it.
+	// +kubebuilder:default=Revert
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
 }
 
+// DriftPolicy controls how the operator handles changes made directly to a generated PrometheusRule
+// +kubebuilder:validation:Enum=Revert;Report
+type DriftPolicy string
+
+const (
+	// DriftPolicyRevert re-applies the generated PrometheusRule, taking back ownership of changed fields
+	DriftPolicyRevert DriftPolicy = "Revert"
+	// DriftPolicyReport leaves the changes in place and reports them on the AlertRule
+	DriftPolicyReport DriftPolicy = "Report"
+)
+
 // AlertGroup defines a group of alerts
 type AlertGroup struct {
 	// Name of the alert group
@@ -27,15 +47,23 @@ type AlertGroup struct {
 	Rules []Rule `json:"rules"`
 }
 
-// Rule defines a single alert rule
+// Rule defines a single alerting or recording rule.
+// Exactly one of Alert or Record must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.alert) != has(self.record)",message="exactly one of alert or record must be set"
 type Rule struct {
 	// Alert name
-	Alert string `json:"alert"`
+	// +optional
+	Alert string `json:"alert,omitempty"`
+
+	// Record is the name of the time series to output to when this is a recording rule
+	// +optional
+	Record string `json:"record,omitempty"`
 
 	// PromQL expression to evaluate
 	Expr string `json:"expr"`
 
-	// For clause - how long the alert must be pending before firing
+	// For clause - how long the alert must be pending before firing.
+	// Only valid for alerting rules.
 	// +optional
 	For string `json:"for,omitempty"`
 
@@ -43,18 +71,78 @@ type Rule struct {
 	// +optional
 	Labels map[string]string `json:"labels,omitempty"`
 
-	// Annotations to add
+	// Annotations to add. Only valid for alerting rules.
 	// +optional
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
+// AlertRuleState is the lifecycle state of an AlertRule
+// +kubebuilder:validation:Enum=Pending;Active;Degraded;Invalid;Deleting
+type AlertRuleState string
+
+const (
+	// AlertRuleStatePending means the AlertRule has not been synced to a PrometheusRule yet
+	AlertRuleStatePending AlertRuleState = "Pending"
+	// AlertRuleStateActive means the PrometheusRule is in sync with the AlertRule
+	AlertRuleStateActive AlertRuleState = "Active"
+	// AlertRuleStateDegraded means the AlertRule is valid but its rules are not live
+	AlertRuleStateDegraded AlertRuleState = "Degraded"
+	// AlertRuleStateInvalid means the spec failed validation and was not synced
+	AlertRuleStateInvalid AlertRuleState = "Invalid"
+	// AlertRuleStateDeleting means the PrometheusRule is being cleaned up
+	AlertRuleStateDeleting AlertRuleState = "Deleting"
+)
+
+// Condition types reported on AlertRuleStatus
+const (
+	// ConditionReady summarizes the other conditions and is True when the rules are live
+	ConditionReady = "Ready"
+	// ConditionValidated is True when the spec passed validation
+	ConditionValidated = "Validated"
+	// ConditionSynced is True when the generated PrometheusRule matches the spec
+	ConditionSynced = "Synced"
+	// ConditionLoadedByPrometheus is True when Prometheus has loaded the generated rules
+	ConditionLoadedByPrometheus = "LoadedByPrometheus"
+	// ConditionDrifted is True when the live PrometheusRule was changed outside the operator
+	ConditionDrifted = "Drifted"
+)
+
+// Condition reasons reported on AlertRuleStatus
+const (
+	ReasonValid                = "Valid"
+	ReasonInvalidSpec          = "InvalidSpec"
+	ReasonInvalidExpression    = "InvalidExpression"
+	ReasonCreated              = "PrometheusRuleCreated"
+	ReasonUpdated              = "PrometheusRuleUpdated"
+	ReasonUnchanged            = "PrometheusRuleUnchanged"
+	ReasonDeleted              = "PrometheusRuleDeleted"
+	ReasonGetFailed            = "GetFailed"
+	ReasonCreateFailed         = "CreateFailed"
+	ReasonUpdateFailed         = "UpdateFailed"
+	ReasonApplyConflict        = "ApplyConflict"
+	ReasonConflictOverridden   = "ConflictOverridden"
+	ReasonOwnerReferenceFailed = "OwnerReferenceFailed"
+	ReasonNotChecked           = "NotChecked"
+	ReasonLoaded               = "Loaded"
+	ReasonNotLoaded            = "NotLoaded"
+	ReasonEvaluationFailed     = "EvaluationFailed"
+	ReasonPrometheusError      = "PrometheusUnreachable"
+	ReasonDriftDetected        = "DriftDetected"
+	ReasonDriftReverted        = "DriftReverted"
+	ReasonInSync               = "InSync"
+	ReasonReconcileSuccess     = "ReconcileSuccess"
+	ReasonPending              = "Pending"
+	ReasonDeleting             = "Deleting"
+)
+
 // AlertRuleStatus defines the observed state of AlertRule
 type AlertRuleStatus struct {
 	// Conditions represent the latest available observations
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
-	// LastReconcileTime is the last time the AlertRule was reconciled
+	// LastReconcileTime is the last time a reconcile changed the status. Reconciles
+	// that find nothing new leave the status, and this time, alone.
 	// +optional
 	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
 
@@ -64,13 +152,68 @@ type AlertRuleStatus struct {
 
 	// State represents the current state of the AlertRule
 	// +optional
-	State string `json:"state,omitempty"`
+	State AlertRuleState `json:"state,omitempty"`
+
+	// FiringCount is the number of alerts currently firing for the AlertRule.
+	// Only populated when the operator is configured to report active alerts.
+	// +optional
+	FiringCount *int32 `json:"firingCount,omitempty"`
+
+	// PendingCount is the number of alerts currently pending for the AlertRule.
+	// Alertmanager doesn't know about pending alerts, so this stays at zero
+	// when alerts are read from Alertmanager.
+	// +optional
+	PendingCount *int32 `json:"pendingCount,omitempty"`
+
+	// Rules reports how Prometheus evaluates each generated rule and how many
+	// alerts each alerting rule has active. Only populated when the operator is
+	// configured with a Prometheus or Alertmanager URL.
+	// +optional
+	Rules []RuleStatus `json:"rules,omitempty"`
+}
+
+// RuleStatus is the evaluation health and active alerts of a single rule
+type RuleStatus struct {
+	// Group is the name of the rule group
+	Group string `json:"group"`
+
+	// Name is the alert or record name of the rule
+	Name string `json:"name"`
+
+	// Health is the rule health reported by Prometheus: ok, err or unknown
+	// +optional
+	Health string `json:"health,omitempty"`
+
+	// LastError is the error of the last evaluation, if it failed
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// LastEvaluation is when Prometheus last evaluated the rule. Like EvaluationTime,
+	// it is only refreshed when something else in the status changes.
+	// +optional
+	LastEvaluation *metav1.Time `json:"lastEvaluation,omitempty"`
+
+	// EvaluationTime is how long the last evaluation took, e.g. "1.2ms"
+	// +optional
+	EvaluationTime string `json:"evaluationTime,omitempty"`
+
+	// Firing is the number of alerts of this rule that are currently firing
+	// +optional
+	Firing int32 `json:"firing,omitempty"`
+
+	// Pending is the number of alerts of this rule that are currently pending
+	// +optional
+	Pending int32 `json:"pending,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced
 // +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.type=="Ready")].message`
+// +kubebuilder:printcolumn:name="Firing",type=integer,JSONPath=`.status.firingCount`
+// +kubebuilder:printcolumn:name="Pending",type=integer,priority=1,JSONPath=`.status.pendingCount`
 // +kubebuilder:printcolumn:name="PrometheusRule",type=string,JSONPath=`.status.prometheusRuleName`
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
@@ -92,6 +235,16 @@ type AlertRuleList struct {
 	Items           []AlertRule `json:"items"`
 }
 
+// AlertRuleFields returns the fields of an AlertRule that can be used in field selectors
+// of the REST API
+func AlertRuleFields(alertRule *AlertRule) fields.Set {
+	return fields.Set{
+		"metadata.name":      alertRule.Name,
+		"metadata.namespace": alertRule.Namespace,
+		"status.state":       string(alertRule.Status.State),
+	}
+}
+
 func init() {
 	SchemeBuilder.Register(&AlertRule{}, &AlertRuleList{})
 }
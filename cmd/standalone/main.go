@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/kneutral-org/kneutral-operator/internal/api"
 	"github.com/kneutral-org/kneutral-operator/internal/mock"
@@ -12,9 +17,12 @@ import (
 func main() {
 	var apiAddr string
 	var mockData bool
+	var corsOrigins string
 
 	flag.StringVar(&apiAddr, "api-bind-address", ":8090", "The address the API server binds to.")
 	flag.BoolVar(&mockData, "mock-data", true, "Enable mock data for testing without Kubernetes")
+	flag.StringVar(&corsOrigins, "api-cors-allowed-origins", "",
+		"Comma separated origins whose browser pages may call the API, \"*\" for any. Empty sends no CORS headers.")
 	flag.Parse()
 
 	fmt.Printf("🚀 Starting Kneutral Operator API in standalone mode\n")
@@ -32,11 +40,15 @@ func main() {
 
 	// Start API server
 	apiServer := api.NewServer(client, apiAddr)
+	apiServer.SetWatchSource(client)
+	apiServer.SetCORSOrigins(strings.Split(corsOrigins, ","))
 	fmt.Printf("🌐 API Documentation: http://localhost%s/docs\n", apiAddr)
 	fmt.Printf("📊 Health Check: http://localhost%s/health\n", apiAddr)
 	fmt.Printf("🔍 List AlertRules: http://localhost%s/api/v1/alertrules\n", apiAddr)
 
-	if err := apiServer.Start(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := apiServer.Start(ctx); err != nil {
 		log.Fatalf("Failed to start API server: %v", err)
 	}
 }
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/prometheus"
+)
+
+// countActiveAlerts records how many alerts each alerting rule of the AlertRule has
+// pending or firing
+func (r *AlertRuleReconciler) countActiveAlerts(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, prometheusRule *monitoringv1.PrometheusRule) {
+	counts, err := r.activeAlerts(ctx, alertRule, prometheusRule)
+	if err != nil {
+		// Counts that can't be refreshed are dropped rather than left stale
+		log.FromContext(ctx).Error(err, "Failed to query active alerts")
+		alertRule.Status.FiringCount = nil
+		alertRule.Status.PendingCount = nil
+		for i := range alertRule.Status.Rules {
+			alertRule.Status.Rules[i].Firing = 0
+			alertRule.Status.Rules[i].Pending = 0
+		}
+		return
+	}
+
+	var firingCount, pendingCount int32
+	for _, group := range alertRule.Spec.Groups {
+		for _, rule := range group.Rules {
+			if rule.Alert == "" {
+				continue
+			}
+
+			count := counts[ruleKey{group: group.Name, name: rule.Alert}]
+			status := ruleStatusFor(alertRule, group.Name, rule.Alert)
+			status.Firing = count.firing
+			status.Pending = count.pending
+			firingCount += count.firing
+			pendingCount += count.pending
+		}
+	}
+
+	alertRule.Status.FiringCount = &firingCount
+	alertRule.Status.PendingCount = &pendingCount
+}
+
+// ruleKey identifies an alerting rule by its group and alert name
+type ruleKey struct {
+	group, name string
+}
+
+// alertCount is the number of pending and firing alerts of a rule
+type alertCount struct {
+	firing, pending int32
+}
+
+// add counts alert
+func (c *alertCount) add(alert prometheus.Alert) {
+	switch alert.State {
+	case "firing":
+		c.firing++
+	case "pending":
+		c.pending++
+	}
+}
+
+// activeAlerts counts the alerts of each alerting rule of the AlertRule. Prometheus lists
+// the alerts of a rule along with it in the rule file generated from prometheusRule, so
+// alerts of same-named rules elsewhere are left out. Alertmanager alerts don't carry the
+// rule file they came from, so they are matched on the alertname label and the rule's
+// static labels.
+func (r *AlertRuleReconciler) activeAlerts(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, prometheusRule *monitoringv1.PrometheusRule) (map[ruleKey]alertCount, error) {
+	counts := map[ruleKey]alertCount{}
+
+	if source, ok := r.Alerts.(*prometheus.Client); ok {
+		groups, err := source.Rules(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if !isPrometheusRuleFile(group.File, prometheusRule) {
+				continue
+			}
+			for _, rule := range group.Rules {
+				if rule.Type != "alerting" {
+					continue
+				}
+				key := ruleKey{group: group.Name, name: rule.Name}
+				count := counts[key]
+				for _, alert := range rule.Alerts {
+					count.add(alert)
+				}
+				counts[key] = count
+			}
+		}
+		return counts, nil
+	}
+
+	alerts, err := r.Alerts.Alerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range alertRule.Spec.Groups {
+		for _, rule := range group.Rules {
+			if rule.Alert == "" {
+				continue
+			}
+			key := ruleKey{group: group.Name, name: rule.Alert}
+			count := counts[key]
+			for _, alert := range alerts {
+				if alertMatchesRule(alert, &rule) {
+					count.add(alert)
+				}
+			}
+			counts[key] = count
+		}
+	}
+	return counts, nil
+}
+
+// alertMatchesRule reports whether an alert was produced by the given alerting rule.
+// Templated label values are expanded per alert, so only static labels are compared.
+func alertMatchesRule(alert prometheus.Alert, rule *monitoringv1alpha1.Rule) bool {
+	if alert.Labels["alertname"] != rule.Alert {
+		return false
+	}
+	for k, v := range rule.Labels {
+		if strings.Contains(v, "{{") {
+			continue
+		}
+		if alert.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleStatusFor returns the status entry of a rule, adding one if rule health isn't
+// being checked or Prometheus hasn't loaded the rule yet
+func ruleStatusFor(alertRule *monitoringv1alpha1.AlertRule, group, name string) *monitoringv1alpha1.RuleStatus {
+	for i := range alertRule.Status.Rules {
+		status := &alertRule.Status.Rules[i]
+		if status.Group == group && status.Name == name {
+			return status
+		}
+	}
+	alertRule.Status.Rules = append(alertRule.Status.Rules, monitoringv1alpha1.RuleStatus{Group: group, Name: name})
+	return &alertRule.Status.Rules[len(alertRule.Status.Rules)-1]
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kneutral-org/kneutral-operator/internal/prometheus"
+)
+
+// staticAlerts is an AlertSource that lists fixed alerts, as Alertmanager would
+type staticAlerts []prometheus.Alert
+
+func (s staticAlerts) Alerts(ctx context.Context) ([]prometheus.Alert, error) {
+	return s, nil
+}
+
+func TestCountActiveAlertsFromRules(t *testing.T) {
+	firing := prometheus.Alert{Labels: map[string]string{"alertname": "HighCPU"}, State: "firing"}
+	pending := prometheus.Alert{Labels: map[string]string{"alertname": "HighCPU"}, State: "pending"}
+	server := rulesServer(t, []prometheus.RuleGroup{
+		{
+			Name:  "cpu.rules",
+			File:  "/etc/prometheus/rules/prometheus-k8s-rulefiles-0/monitoring-kneutral-cpu-1234.yaml",
+			Rules: []prometheus.Rule{{Name: "HighCPU", Type: "alerting", Health: "ok", Alerts: []prometheus.Alert{firing, pending}}},
+		},
+		{
+			// The same alert defined by an AlertRule in another namespace
+			Name:  "cpu.rules",
+			File:  "/etc/prometheus/rules/prometheus-k8s-rulefiles-0/production-kneutral-cpu-5678.yaml",
+			Rules: []prometheus.Rule{{Name: "HighCPU", Type: "alerting", Health: "ok", Alerts: []prometheus.Alert{firing, firing}}},
+		},
+	})
+	client := prometheus.NewClient(server.URL, time.Minute)
+	r := &AlertRuleReconciler{Prometheus: client, Alerts: client}
+	alertRule, prometheusRule := healthTestAlertRule("cpu.rules")
+
+	r.checkRuleHealth(context.Background(), alertRule, prometheusRule)
+	r.countActiveAlerts(context.Background(), alertRule, prometheusRule)
+
+	if alertRule.Status.FiringCount == nil || *alertRule.Status.FiringCount != 1 ||
+		alertRule.Status.PendingCount == nil || *alertRule.Status.PendingCount != 1 {
+		t.Errorf("firingCount = %v, pendingCount = %v, want 1 and 1", alertRule.Status.FiringCount, alertRule.Status.PendingCount)
+	}
+	if len(alertRule.Status.Rules) != 1 || alertRule.Status.Rules[0].Firing != 1 || alertRule.Status.Rules[0].Pending != 1 {
+		t.Errorf("status.rules = %+v, want HighCPU with 1 firing and 1 pending", alertRule.Status.Rules)
+	}
+}
+
+func TestCountActiveAlertsByLabels(t *testing.T) {
+	alertRule, prometheusRule := healthTestAlertRule("cpu.rules")
+	alertRule.Spec.Groups[0].Rules[0].Labels = map[string]string{"severity": "critical", "instance": "{{ $labels.instance }}"}
+	r := &AlertRuleReconciler{Alerts: staticAlerts{
+		{Labels: map[string]string{"alertname": "HighCPU", "severity": "critical", "instance": "a"}, State: "firing"},
+		{Labels: map[string]string{"alertname": "HighCPU", "severity": "critical", "instance": "b"}, State: "firing"},
+		{Labels: map[string]string{"alertname": "HighCPU", "severity": "warning"}, State: "firing"},
+		{Labels: map[string]string{"alertname": "HighMemory", "severity": "critical"}, State: "firing"},
+	}}
+
+	r.countActiveAlerts(context.Background(), alertRule, prometheusRule)
+
+	if alertRule.Status.FiringCount == nil || *alertRule.Status.FiringCount != 2 {
+		t.Errorf("firingCount = %v, want 2", alertRule.Status.FiringCount)
+	}
+	if len(alertRule.Status.Rules) != 1 || alertRule.Status.Rules[0].Firing != 2 {
+		t.Errorf("status.rules = %+v, want HighCPU with 2 firing", alertRule.Status.Rules)
+	}
+}
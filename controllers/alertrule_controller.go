@@ -2,34 +2,66 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/csaupgrade"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/prometheus"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
 )
 
+// FieldManager is the field manager the operator applies PrometheusRules with
+const FieldManager = "kneutral-operator"
+
+// legacyFieldManager is the manager the API server recorded for PrometheusRules written
+// with Create and Update by earlier releases, which derive it from the binary name
+var legacyFieldManager = filepath.Base(os.Args[0])
+
 // AlertRuleReconciler reconciles a AlertRule object
 type AlertRuleReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Log    logr.Logger
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+
+	// Prometheus, when set, is polled for the evaluation health of generated rules
+	Prometheus *prometheus.Client
+	// Alerts, when set, is polled for the alerts each AlertRule has pending or firing
+	Alerts prometheus.AlertSource
+	// PrometheusPollInterval is how often rule health and active alerts are refreshed
+	PrometheusPollInterval time.Duration
 }
 
 // +kubebuilder:rbac:groups=monitoring.kneutral.io,resources=alertrules,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=monitoring.kneutral.io,resources=alertrules/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=monitoring.kneutral.io,resources=alertrules/finalizers,verbs=update
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;list;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop
 func (r *AlertRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -49,11 +81,22 @@ func (r *AlertRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		log.Error(err, "Failed to get AlertRule")
 		return ctrl.Result{}, err
 	}
+	// The status as read, so that a reconcile that changes nothing doesn't write it
+	original := alertRule.Status.DeepCopy()
 
 	// Check if the AlertRule is being deleted
 	if !alertRule.ObjectMeta.DeletionTimestamp.IsZero() {
 		// The object is being deleted
 		if controllerutil.ContainsFinalizer(alertRule, "alertrule.kneutral.io/finalizer") {
+			if alertRule.Status.State != monitoringv1alpha1.AlertRuleStateDeleting {
+				setCondition(alertRule, monitoringv1alpha1.ConditionReady, metav1.ConditionFalse, monitoringv1alpha1.ReasonDeleting,
+					"AlertRule is being deleted")
+				// The object is going away, so a failed status write is not worth retrying
+				if err := r.updateStatus(ctx, alertRule, original); err != nil {
+					log.Error(err, "Failed to record Deleting state")
+				}
+			}
+
 			// Delete the associated PrometheusRule
 			if err := r.deletePrometheusRule(ctx, alertRule); err != nil {
 				log.Error(err, "Failed to delete PrometheusRule")
@@ -77,102 +120,183 @@ func (r *AlertRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
+	// Validate the spec before anything is written to the cluster. The spec has to
+	// change to fix a validation error, which triggers a new reconcile, so don't requeue.
+	if errs := validation.ValidateAlertRuleSpec(&alertRule.Spec); len(errs) > 0 {
+		reason := validation.FailureReason(&alertRule.Spec)
+		metrics.ValidationFailuresTotal.WithLabelValues(reason, metrics.SourceController).Inc()
+		log.Info("AlertRule failed validation", "reason", reason, "errors", errs.ToAggregate().Error())
+		setCondition(alertRule, monitoringv1alpha1.ConditionValidated, metav1.ConditionFalse, reason, errs.ToAggregate().Error())
+		r.Recorder.Event(alertRule, corev1.EventTypeWarning, reason, errs.ToAggregate().Error())
+		return ctrl.Result{}, r.updateStatus(ctx, alertRule, original)
+	}
+	setCondition(alertRule, monitoringv1alpha1.ConditionValidated, metav1.ConditionTrue, monitoringv1alpha1.ReasonValid,
+		"AlertRule spec is valid")
+
 	// Generate PrometheusRule from AlertRule
-	prometheusRule := r.generatePrometheusRule(alertRule)
+	prometheusRule := render.GeneratePrometheusRule(alertRule)
+	alertRule.Status.PrometheusRuleName = prometheusRule.Name
 
 	// Set AlertRule as the owner of the PrometheusRule
 	if err := controllerutil.SetControllerReference(alertRule, prometheusRule, r.Scheme); err != nil {
 		log.Error(err, "Failed to set owner reference")
-		return ctrl.Result{}, err
+		return r.syncFailed(ctx, alertRule, original, monitoringv1alpha1.ReasonOwnerReferenceFailed, err)
 	}
 
-	// Check if PrometheusRule already exists
+	// The live object decides the reported reason and whether the apply can be skipped
 	found := &monitoringv1.PrometheusRule{}
 	err = r.Get(ctx, types.NamespacedName{Name: prometheusRule.Name, Namespace: prometheusRule.Namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new PrometheusRule", "PrometheusRule.Namespace", prometheusRule.Namespace, "PrometheusRule.Name", prometheusRule.Name)
-		err = r.Create(ctx, prometheusRule)
-		if err != nil {
-			log.Error(err, "Failed to create new PrometheusRule", "PrometheusRule.Namespace", prometheusRule.Namespace, "PrometheusRule.Name", prometheusRule.Name)
-			return ctrl.Result{}, err
-		}
-		// PrometheusRule created successfully - update status
-		return r.updateStatus(ctx, alertRule, prometheusRule.Name, "Active")
-	} else if err != nil {
+	exists := err == nil
+	if err != nil && !errors.IsNotFound(err) {
 		log.Error(err, "Failed to get PrometheusRule")
-		return ctrl.Result{}, err
+		return r.syncFailed(ctx, alertRule, original, monitoringv1alpha1.ReasonGetFailed, err)
 	}
 
-	// PrometheusRule already exists - update it
-	found.Spec = prometheusRule.Spec
-	found.Labels = prometheusRule.Labels
-	log.Info("Updating existing PrometheusRule", "PrometheusRule.Namespace", found.Namespace, "PrometheusRule.Name", found.Name)
-	err = r.Update(ctx, found)
-	if err != nil {
-		log.Error(err, "Failed to update PrometheusRule", "PrometheusRule.Namespace", found.Namespace, "PrometheusRule.Name", found.Name)
-		return ctrl.Result{}, err
+	drifted := exists && isDrifted(found)
+	revert := alertRule.Spec.DriftPolicy != monitoringv1alpha1.DriftPolicyReport
+	if drifted {
+		message := fmt.Sprintf("PrometheusRule %s was modified outside the operator", found.Name)
+		log.Info("PrometheusRule drifted from the generated spec", "PrometheusRule.Namespace", found.Namespace, "PrometheusRule.Name", found.Name, "driftPolicy", alertRule.Spec.DriftPolicy)
+		if !revert {
+			// Every poll finds the drift again, so only its start is worth an event
+			if !meta.IsStatusConditionTrue(alertRule.Status.Conditions, monitoringv1alpha1.ConditionDrifted) {
+				r.Recorder.Event(alertRule, corev1.EventTypeWarning, monitoringv1alpha1.ReasonDriftDetected, message)
+			}
+			setCondition(alertRule, monitoringv1alpha1.ConditionDrifted, metav1.ConditionTrue, monitoringv1alpha1.ReasonDriftDetected, message)
+			// Only overwrite the changes once the AlertRule itself changes
+			if found.Annotations[render.SpecHashAnnotation] == prometheusRule.Annotations[render.SpecHashAnnotation] {
+				return r.syncSucceeded(ctx, alertRule, original, found, monitoringv1alpha1.ReasonUnchanged,
+					fmt.Sprintf("PrometheusRule %s left as modified since the drift policy is Report", found.Name))
+			}
+		}
+	} else {
+		setCondition(alertRule, monitoringv1alpha1.ConditionDrifted, metav1.ConditionFalse, monitoringv1alpha1.ReasonInSync,
+			"PrometheusRule matches the last applied spec")
 	}
 
-	// Update status
-	return r.updateStatus(ctx, alertRule, found.Name, "Active")
-}
+	if exists && prometheusRuleUpToDate(found, prometheusRule) {
+		return r.syncSucceeded(ctx, alertRule, original, found, monitoringv1alpha1.ReasonUnchanged,
+			fmt.Sprintf("PrometheusRule %s is up to date", found.Name))
+	}
+
+	if exists {
+		if err := r.upgradeManagedFields(ctx, found); err != nil {
+			log.Error(err, "Failed to migrate PrometheusRule field ownership", "PrometheusRule.Namespace", found.Namespace, "PrometheusRule.Name", found.Name)
+			return r.syncFailed(ctx, alertRule, original, monitoringv1alpha1.ReasonUpdateFailed, err)
+		}
+	}
 
-// generatePrometheusRule creates a PrometheusRule from an AlertRule
-func (r *AlertRuleReconciler) generatePrometheusRule(alertRule *monitoringv1alpha1.AlertRule) *monitoringv1.PrometheusRule {
-	labels := map[string]string{
-		"app.kubernetes.io/managed-by": "kneutral-operator",
-		"app.kubernetes.io/instance":   "kneutral",
-		"app.kubernetes.io/name":       alertRule.Name,
+	// Server-side apply only touches the fields the operator owns, so labels, annotations
+	// and anything else other tools add to the PrometheusRule are left alone. A field
+	// someone else changed is a conflict, which is always recorded. With the Revert drift
+	// policy the operator then takes the field back; with Report the sync fails, unless
+	// the drift was already reported and the AlertRule has changed since, which replaces
+	// the hand edits just as it would with Revert.
+	log.Info("Applying PrometheusRule", "PrometheusRule.Namespace", prometheusRule.Namespace, "PrometheusRule.Name", prometheusRule.Name)
+	err = r.Patch(ctx, prometheusRule, client.Apply, client.FieldOwner(FieldManager))
+	conflictOverridden := false
+	if errors.IsConflict(err) && (revert || drifted) {
+		r.Recorder.Event(alertRule, corev1.EventTypeWarning, monitoringv1alpha1.ReasonApplyConflict,
+			fmt.Sprintf("Taking over fields of PrometheusRule %s owned by another field manager: %v", prometheusRule.Name, err))
+		log.Info("Forcing apply of conflicting PrometheusRule fields", "PrometheusRule.Namespace", prometheusRule.Namespace, "PrometheusRule.Name", prometheusRule.Name, "conflict", err.Error())
+		err = r.Patch(ctx, prometheusRule, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+		conflictOverridden = err == nil
+	}
+	if err != nil {
+		log.Error(err, "Failed to apply PrometheusRule", "PrometheusRule.Namespace", prometheusRule.Namespace, "PrometheusRule.Name", prometheusRule.Name)
+		switch {
+		case errors.IsConflict(err):
+			return r.syncFailed(ctx, alertRule, original, monitoringv1alpha1.ReasonApplyConflict, err)
+		case exists:
+			return r.syncFailed(ctx, alertRule, original, monitoringv1alpha1.ReasonUpdateFailed, err)
+		default:
+			return r.syncFailed(ctx, alertRule, original, monitoringv1alpha1.ReasonCreateFailed, err)
+		}
 	}
 
-	// Merge user-provided labels
-	for k, v := range alertRule.Spec.Labels {
-		labels[k] = v
+	switch {
+	case drifted && revert:
+		message := fmt.Sprintf("Reverted changes made outside the operator to PrometheusRule %s", prometheusRule.Name)
+		setCondition(alertRule, monitoringv1alpha1.ConditionDrifted, metav1.ConditionFalse, monitoringv1alpha1.ReasonDriftReverted, message)
+		r.Recorder.Event(alertRule, corev1.EventTypeWarning, monitoringv1alpha1.ReasonDriftReverted, message)
+	case drifted:
+		// The changed AlertRule spec replaced the reported drift
+		setCondition(alertRule, monitoringv1alpha1.ConditionDrifted, metav1.ConditionFalse, monitoringv1alpha1.ReasonInSync,
+			"PrometheusRule matches the last applied spec")
 	}
 
-	prometheusRule := &monitoringv1.PrometheusRule{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("kneutral-%s", alertRule.Name),
-			Namespace: alertRule.Namespace,
-			Labels:    labels,
-		},
-		Spec: monitoringv1.PrometheusRuleSpec{
-			Groups: []monitoringv1.RuleGroup{},
-		},
+	if conflictOverridden {
+		return r.syncSucceeded(ctx, alertRule, original, prometheusRule, monitoringv1alpha1.ReasonConflictOverridden,
+			fmt.Sprintf("PrometheusRule %s updated, taking over fields another field manager owned", prometheusRule.Name))
 	}
+	if !exists {
+		return r.syncSucceeded(ctx, alertRule, original, prometheusRule, monitoringv1alpha1.ReasonCreated,
+			fmt.Sprintf("PrometheusRule %s created", prometheusRule.Name))
+	}
+	return r.syncSucceeded(ctx, alertRule, original, prometheusRule, monitoringv1alpha1.ReasonUpdated,
+		fmt.Sprintf("PrometheusRule %s updated", prometheusRule.Name))
+}
 
-	// Convert AlertGroups to RuleGroups
-	for _, group := range alertRule.Spec.Groups {
-		ruleGroup := monitoringv1.RuleGroup{
-			Name: group.Name,
+// prometheusRuleUpToDate reports whether the live PrometheusRule already matches the
+// generated one, so the apply can be skipped
+func prometheusRuleUpToDate(live, desired *monitoringv1.PrometheusRule) bool {
+	if !equality.Semantic.DeepEqual(live.Spec, desired.Spec) {
+		return false
+	}
+	for k, v := range desired.Labels {
+		if live.Labels[k] != v {
+			return false
 		}
+	}
+	// Labels the operator set before but no longer generates have to be removed by an apply
+	if appliedLabels(live) != len(desired.Labels) {
+		return false
+	}
+	if live.Annotations[render.SpecHashAnnotation] != desired.Annotations[render.SpecHashAnnotation] {
+		return false
+	}
+	owner := metav1.GetControllerOf(desired)
+	liveOwner := metav1.GetControllerOf(live)
+	return owner != nil && liveOwner != nil && owner.UID == liveOwner.UID
+}
 
-		if group.Interval != "" {
-			interval := monitoringv1.Duration(group.Interval)
-			ruleGroup.Interval = &interval
+// appliedLabels returns how many labels the operator owns on the live object, or -1 if
+// the operator has never applied it
+func appliedLabels(live *monitoringv1.PrometheusRule) int {
+	for _, entry := range live.ManagedFields {
+		if entry.Manager != FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
 		}
-
-		// Convert Rules
-		for _, rule := range group.Rules {
-			promRule := monitoringv1.Rule{
-				Alert:       rule.Alert,
-				Expr:        intstr.FromString(rule.Expr),
-				Labels:      rule.Labels,
-				Annotations: rule.Annotations,
-			}
-
-			if rule.For != "" {
-				forDuration := monitoringv1.Duration(rule.For)
-				promRule.For = &forDuration
+		var fields struct {
+			Metadata struct {
+				Labels map[string]interface{} `json:"f:labels"`
+			} `json:"f:metadata"`
+		}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return -1
+		}
+		// Keys are "f:<label>", plus "." when the labels map itself is owned
+		count := 0
+		for key := range fields.Metadata.Labels {
+			if strings.HasPrefix(key, "f:") {
+				count++
 			}
-
-			ruleGroup.Rules = append(ruleGroup.Rules, promRule)
 		}
-
-		prometheusRule.Spec.Groups = append(prometheusRule.Spec.Groups, ruleGroup)
+		return count
 	}
+	return -1
+}
 
-	return prometheusRule
+// upgradeManagedFields hands the fields that earlier releases wrote with Update over to
+// the apply field manager. Without this the first change to an AlertRule after an upgrade
+// would conflict with the operator's own previous writes.
+func (r *AlertRuleReconciler) upgradeManagedFields(ctx context.Context, live *monitoringv1.PrometheusRule) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(live, sets.New(legacyFieldManager), FieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Migrating PrometheusRule field ownership to server-side apply", "PrometheusRule.Namespace", live.Namespace, "PrometheusRule.Name", live.Name)
+	return r.Patch(ctx, live, client.RawPatch(types.JSONPatchType, patch))
 }
 
 // deletePrometheusRule deletes the PrometheusRule associated with an AlertRule
@@ -190,52 +314,172 @@ func (r *AlertRuleReconciler) deletePrometheusRule(ctx context.Context, alertRul
 		return err
 	}
 
-	return r.Delete(ctx, prometheusRule)
+	if err := r.Delete(ctx, prometheusRule); err != nil {
+		return err
+	}
+	metrics.PrometheusRuleSizeBytes.DeleteLabelValues(prometheusRule.Namespace, prometheusRule.Name)
+	r.Recorder.Eventf(alertRule, corev1.EventTypeNormal, monitoringv1alpha1.ReasonDeleted, "PrometheusRule %s deleted", prometheusRule.Name)
+	return nil
+}
+
+// syncSucceeded records a successful write of the PrometheusRule and, when a Prometheus or
+// Alertmanager URL is configured, checks rule health and active alerts and schedules the next check
+func (r *AlertRuleReconciler) syncSucceeded(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, original *monitoringv1alpha1.AlertRuleStatus, prometheusRule *monitoringv1.PrometheusRule, reason, message string) (ctrl.Result, error) {
+	// Polling finds the PrometheusRule unchanged every time, so that is only worth an
+	// event when it is the outcome of a spec change
+	synced := meta.FindStatusCondition(alertRule.Status.Conditions, monitoringv1alpha1.ConditionSynced)
+	if reason != monitoringv1alpha1.ReasonUnchanged || synced == nil || synced.ObservedGeneration != alertRule.Generation {
+		r.Recorder.Event(alertRule, corev1.EventTypeNormal, reason, message)
+	}
+	setCondition(alertRule, monitoringv1alpha1.ConditionSynced, metav1.ConditionTrue, reason, message)
+
+	if spec, err := json.Marshal(prometheusRule.Spec); err == nil {
+		metrics.PrometheusRuleSizeBytes.WithLabelValues(prometheusRule.Namespace, prometheusRule.Name).Set(float64(len(spec)))
+	}
+
+	if r.Prometheus != nil {
+		r.checkRuleHealth(ctx, alertRule, prometheusRule)
+	} else {
+		setCondition(alertRule, monitoringv1alpha1.ConditionLoadedByPrometheus, metav1.ConditionUnknown, monitoringv1alpha1.ReasonNotChecked,
+			"Prometheus rule health is not being checked")
+		alertRule.Status.Rules = nil
+	}
+
+	if r.Alerts != nil {
+		r.countActiveAlerts(ctx, alertRule, prometheusRule)
+	}
+
+	if err := r.updateStatus(ctx, alertRule, original); err != nil {
+		return ctrl.Result{}, err
+	}
+	if r.Prometheus == nil && r.Alerts == nil {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.PrometheusPollInterval}, nil
 }
 
-// updateStatus updates the AlertRule status
-func (r *AlertRuleReconciler) updateStatus(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, prometheusRuleName, state string) (ctrl.Result, error) {
+// syncFailed records a failed write of the PrometheusRule and returns the error so the request is retried
+func (r *AlertRuleReconciler) syncFailed(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, original *monitoringv1alpha1.AlertRuleStatus, reason string, err error) (ctrl.Result, error) {
+	setCondition(alertRule, monitoringv1alpha1.ConditionSynced, metav1.ConditionFalse, reason, err.Error())
+	r.Recorder.Event(alertRule, corev1.EventTypeWarning, reason, err.Error())
+	if statusErr := r.updateStatus(ctx, alertRule, original); statusErr != nil {
+		log.FromContext(ctx).Error(statusErr, "Failed to record sync failure")
+	}
+	return ctrl.Result{}, err
+}
+
+// updateStatus derives the state and Ready condition from the other conditions and
+// writes the AlertRule status, unless it is the same as the original status read by the
+// reconcile. Every write bumps the resourceVersion, which invalidates ETags and adds a
+// watch event, so a poll that finds nothing new leaves the AlertRule alone.
+func (r *AlertRuleReconciler) updateStatus(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, original *monitoringv1alpha1.AlertRuleStatus) error {
+	alertRule.Status.State = computeState(alertRule)
+
+	switch alertRule.Status.State {
+	case monitoringv1alpha1.AlertRuleStateActive:
+		setCondition(alertRule, monitoringv1alpha1.ConditionReady, metav1.ConditionTrue, monitoringv1alpha1.ReasonReconcileSuccess,
+			fmt.Sprintf("PrometheusRule %s is in sync", alertRule.Status.PrometheusRuleName))
+	case monitoringv1alpha1.AlertRuleStateDeleting:
+		// Ready was already set to Deleting by the caller
+	default:
+		// Surface the first failing, or else the first pending, condition so kubectl get
+		// shows why the rule isn't live
+		reason, message := monitoringv1alpha1.ReasonPending, "PrometheusRule has not been synced yet"
+		if c := firstConditionWithStatus(alertRule, metav1.ConditionFalse); c != nil {
+			reason, message = c.Reason, c.Message
+		} else if c := meta.FindStatusCondition(alertRule.Status.Conditions, monitoringv1alpha1.ConditionDrifted); c != nil && c.Status == metav1.ConditionTrue {
+			reason, message = c.Reason, c.Message
+		} else if c := firstConditionWithStatus(alertRule, metav1.ConditionUnknown); c != nil {
+			reason, message = c.Reason, c.Message
+		}
+		setCondition(alertRule, monitoringv1alpha1.ConditionReady, metav1.ConditionFalse, reason, message)
+	}
+
+	if !statusChanged(original, &alertRule.Status) {
+		alertRule.Status.LastReconcileTime = original.LastReconcileTime
+		return nil
+	}
 	now := metav1.Now()
 	alertRule.Status.LastReconcileTime = &now
-	alertRule.Status.PrometheusRuleName = prometheusRuleName
-	alertRule.Status.State = state
-
-	// Update conditions
-	condition := metav1.Condition{
-		Type:               "Ready",
-		Status:             metav1.ConditionTrue,
-		ObservedGeneration: alertRule.Generation,
-		LastTransitionTime: now,
-		Reason:             "ReconcileSuccess",
-		Message:            fmt.Sprintf("PrometheusRule %s created/updated successfully", prometheusRuleName),
+	if err := r.Status().Update(ctx, alertRule); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update AlertRule status")
+		return err
 	}
 
-	// Update or append the condition
-	found := false
-	for i, c := range alertRule.Status.Conditions {
-		if c.Type == condition.Type {
-			alertRule.Status.Conditions[i] = condition
-			found = true
-			break
+	return nil
+}
+
+// statusChanged reports whether a reconcile changed the status. The reconcile time and
+// the evaluation timings Prometheus reports change on every poll, so they are only
+// written along with another change.
+func statusChanged(original, status *monitoringv1alpha1.AlertRuleStatus) bool {
+	original, status = original.DeepCopy(), status.DeepCopy()
+	for _, s := range []*monitoringv1alpha1.AlertRuleStatus{original, status} {
+		s.LastReconcileTime = nil
+		for i := range s.Rules {
+			s.Rules[i].LastEvaluation = nil
+			s.Rules[i].EvaluationTime = ""
 		}
 	}
-	if !found {
-		alertRule.Status.Conditions = append(alertRule.Status.Conditions, condition)
+	return !equality.Semantic.DeepEqual(original, status)
+}
+
+// computeState maps the conditions of an AlertRule onto its lifecycle state
+func computeState(alertRule *monitoringv1alpha1.AlertRule) monitoringv1alpha1.AlertRuleState {
+	conditions := alertRule.Status.Conditions
+
+	switch {
+	case !alertRule.DeletionTimestamp.IsZero():
+		return monitoringv1alpha1.AlertRuleStateDeleting
+	case meta.IsStatusConditionFalse(conditions, monitoringv1alpha1.ConditionValidated):
+		return monitoringv1alpha1.AlertRuleStateInvalid
+	case meta.IsStatusConditionFalse(conditions, monitoringv1alpha1.ConditionSynced),
+		meta.IsStatusConditionFalse(conditions, monitoringv1alpha1.ConditionLoadedByPrometheus),
+		meta.IsStatusConditionTrue(conditions, monitoringv1alpha1.ConditionDrifted):
+		return monitoringv1alpha1.AlertRuleStateDegraded
+	case meta.IsStatusConditionTrue(conditions, monitoringv1alpha1.ConditionSynced):
+		// Still waiting for Prometheus to pick up the rules
+		if c := meta.FindStatusCondition(conditions, monitoringv1alpha1.ConditionLoadedByPrometheus); c != nil && c.Reason == monitoringv1alpha1.ReasonNotLoaded {
+			return monitoringv1alpha1.AlertRuleStatePending
+		}
+		return monitoringv1alpha1.AlertRuleStateActive
+	default:
+		return monitoringv1alpha1.AlertRuleStatePending
 	}
+}
 
-	err := r.Status().Update(ctx, alertRule)
-	if err != nil {
-		log.FromContext(ctx).Error(err, "Failed to update AlertRule status")
-		return ctrl.Result{}, err
+// firstConditionWithStatus returns the first stage condition, in reconcile order, with the given status
+func firstConditionWithStatus(alertRule *monitoringv1alpha1.AlertRule, status metav1.ConditionStatus) *metav1.Condition {
+	for _, conditionType := range []string{
+		monitoringv1alpha1.ConditionValidated,
+		monitoringv1alpha1.ConditionSynced,
+		monitoringv1alpha1.ConditionLoadedByPrometheus,
+	} {
+		if c := meta.FindStatusCondition(alertRule.Status.Conditions, conditionType); c != nil && c.Status == status {
+			return c
+		}
 	}
+	return nil
+}
 
-	return ctrl.Result{}, nil
+// setCondition updates or appends a condition on the AlertRule status. The transition
+// time only changes when the status does.
+func setCondition(alertRule *monitoringv1alpha1.AlertRule, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&alertRule.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: alertRule.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AlertRuleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Status writes don't bump the generation, so ignoring them keeps the controller from
+	// reconciling its own status updates. Rule health is refreshed with RequeueAfter instead.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&monitoringv1alpha1.AlertRule{}).
+		For(&monitoringv1alpha1.AlertRule{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Owns(&monitoringv1.PrometheusRule{}).
 		Complete(r)
 }
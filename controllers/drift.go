@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+)
+
+// isDrifted reports whether the live PrometheusRule no longer matches the spec the operator
+// last applied to it. Objects written before the hash annotation existed are never drifted.
+func isDrifted(live *monitoringv1.PrometheusRule) bool {
+	applied, ok := live.Annotations[render.SpecHashAnnotation]
+	return ok && applied != render.SpecHash(&live.Spec)
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+)
+
+// drainEvents returns the events recorded so far
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestDriftReportedOnce(t *testing.T) {
+	scheme := testScheme(t)
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "cpu",
+			Namespace:  "monitoring",
+			UID:        "alertrule-uid",
+			Generation: 1,
+			Finalizers: []string{"alertrule.kneutral.io/finalizer"},
+		},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			DriftPolicy: monitoringv1alpha1.DriftPolicyReport,
+			Groups: []monitoringv1alpha1.AlertGroup{{
+				Name:  "cpu.rules",
+				Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 90"}},
+			}},
+		},
+	}
+
+	// The generated PrometheusRule, edited by hand afterwards
+	prometheusRule := render.GeneratePrometheusRule(alertRule)
+	if err := controllerutil.SetControllerReference(alertRule, prometheusRule, scheme); err != nil {
+		t.Fatal(err)
+	}
+	prometheusRule.Spec.Groups[0].Rules[0].Expr = intstr.FromString("cpu > 99")
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(alertRule, prometheusRule).
+		WithStatusSubresource(&monitoringv1alpha1.AlertRule{}).
+		Build()
+	recorder := record.NewFakeRecorder(100)
+	r := &AlertRuleReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "monitoring", Name: "cpu"}}
+
+	var detected int
+	for i := 0; i < 3; i++ {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("reconcile %d: %v", i, err)
+		}
+		for _, event := range drainEvents(recorder) {
+			if strings.Contains(event, monitoringv1alpha1.ReasonDriftDetected) {
+				detected++
+			}
+		}
+	}
+	if detected != 1 {
+		t.Errorf("DriftDetected events = %d, want 1", detected)
+	}
+
+	got := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, monitoringv1alpha1.ConditionDrifted) {
+		t.Errorf("Drifted condition = %+v, want True", meta.FindStatusCondition(got.Status.Conditions, monitoringv1alpha1.ConditionDrifted))
+	}
+
+	live := &monitoringv1.PrometheusRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "kneutral-cpu"}, live); err != nil {
+		t.Fatal(err)
+	}
+	if expr := live.Spec.Groups[0].Rules[0].Expr.String(); expr != "cpu > 99" {
+		t.Errorf("hand edit was overwritten, expr = %q", expr)
+	}
+}
+
+func TestReportedDriftReplacedBySpecChange(t *testing.T) {
+	scheme := testScheme(t)
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "cpu",
+			Namespace:  "monitoring",
+			UID:        "alertrule-uid",
+			Generation: 1,
+			Finalizers: []string{"alertrule.kneutral.io/finalizer"},
+		},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			DriftPolicy: monitoringv1alpha1.DriftPolicyReport,
+			Groups: []monitoringv1alpha1.AlertGroup{{
+				Name:  "cpu.rules",
+				Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 90"}},
+			}},
+		},
+	}
+
+	// The PrometheusRule generated for the first generation, then edited by hand
+	prometheusRule := render.GeneratePrometheusRule(alertRule)
+	if err := controllerutil.SetControllerReference(alertRule, prometheusRule, scheme); err != nil {
+		t.Fatal(err)
+	}
+	prometheusRule.Spec.Groups[0].Rules[0].Expr = intstr.FromString("cpu > 99")
+
+	// The AlertRule has since changed
+	alertRule.Generation = 2
+	alertRule.Spec.Groups[0].Rules[0].Expr = "cpu > 95"
+
+	// The hand-edited field belongs to another field manager, so only a forced apply can
+	// write it
+	var forced bool
+	c := interceptor.NewClient(newApplyClient(scheme, alertRule, prometheusRule), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patchOpts := &client.PatchOptions{}
+			patchOpts.ApplyOptions(opts)
+			if _, ok := obj.(*monitoringv1.PrometheusRule); ok && patch.Type() == types.ApplyPatchType {
+				if patchOpts.Force == nil || !*patchOpts.Force {
+					return errors.NewConflict(schema.GroupResource{Group: monitoringv1.SchemeGroupVersion.Group, Resource: "prometheusrules"},
+						obj.GetName(), fmt.Errorf(`Apply failed with 1 conflict: conflict with "kubectl-edit": .spec.groups`))
+				}
+				forced = true
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+	r := &AlertRuleReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(100)}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "monitoring", Name: "cpu"}}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if !forced {
+		t.Error("the spec change was not force-applied")
+	}
+
+	live := &monitoringv1.PrometheusRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "kneutral-cpu"}, live); err != nil {
+		t.Fatal(err)
+	}
+	if expr := live.Spec.Groups[0].Rules[0].Expr.String(); expr != "cpu > 95" {
+		t.Errorf("expr = %q, want the changed spec's cpu > 95", expr)
+	}
+
+	got := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if drifted := meta.FindStatusCondition(got.Status.Conditions, monitoringv1alpha1.ConditionDrifted); drifted == nil || drifted.Status != metav1.ConditionFalse {
+		t.Errorf("Drifted condition = %+v, want False", drifted)
+	}
+	if synced := meta.FindStatusCondition(got.Status.Conditions, monitoringv1alpha1.ConditionSynced); synced == nil || synced.Reason != monitoringv1alpha1.ReasonConflictOverridden {
+		t.Errorf("Synced condition = %+v, want reason %s", synced, monitoringv1alpha1.ReasonConflictOverridden)
+	}
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/prometheus"
+)
+
+// checkRuleHealth matches the rule groups loaded by Prometheus against the groups generated
+// for the AlertRule and records per-rule health and the LoadedByPrometheus condition
+func (r *AlertRuleReconciler) checkRuleHealth(ctx context.Context, alertRule *monitoringv1alpha1.AlertRule, prometheusRule *monitoringv1.PrometheusRule) {
+	groups, err := r.Prometheus.Rules(ctx)
+	if err != nil {
+		// Without an answer from Prometheus nothing confirms the rules are evaluated
+		setCondition(alertRule, monitoringv1alpha1.ConditionLoadedByPrometheus, metav1.ConditionFalse, monitoringv1alpha1.ReasonPrometheusError,
+			fmt.Sprintf("Failed to query Prometheus rules: %v", err))
+		return
+	}
+
+	// Group names are only unique within a rule file, so match on the file as well
+	loaded := map[string]prometheus.RuleGroup{}
+	for _, group := range groups {
+		if isPrometheusRuleFile(group.File, prometheusRule) {
+			loaded[group.Name] = group
+		}
+	}
+
+	var missing, failing []string
+	statuses := []monitoringv1alpha1.RuleStatus{}
+	for _, group := range alertRule.Spec.Groups {
+		loadedGroup, ok := loaded[group.Name]
+		if !ok {
+			missing = append(missing, group.Name)
+			continue
+		}
+
+		for _, rule := range loadedGroup.Rules {
+			status := monitoringv1alpha1.RuleStatus{
+				Group:          loadedGroup.Name,
+				Name:           rule.Name,
+				Health:         rule.Health,
+				LastError:      rule.LastError,
+				EvaluationTime: time.Duration(rule.EvaluationTime * float64(time.Second)).String(),
+			}
+			if !rule.LastEvaluation.IsZero() {
+				lastEvaluation := metav1.NewTime(rule.LastEvaluation)
+				status.LastEvaluation = &lastEvaluation
+			}
+			if rule.Health == "err" {
+				failing = append(failing, fmt.Sprintf("%s/%s: %s", loadedGroup.Name, rule.Name, rule.LastError))
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	alertRule.Status.Rules = statuses
+
+	switch {
+	case len(failing) > 0:
+		setCondition(alertRule, monitoringv1alpha1.ConditionLoadedByPrometheus, metav1.ConditionFalse, monitoringv1alpha1.ReasonEvaluationFailed,
+			strings.Join(failing, "; "))
+	case len(missing) > 0:
+		// Prometheus Operator and the config reloader take a while to pick up changes
+		setCondition(alertRule, monitoringv1alpha1.ConditionLoadedByPrometheus, metav1.ConditionUnknown, monitoringv1alpha1.ReasonNotLoaded,
+			fmt.Sprintf("Prometheus has not loaded groups: %s", strings.Join(missing, ", ")))
+	default:
+		setCondition(alertRule, monitoringv1alpha1.ConditionLoadedByPrometheus, metav1.ConditionTrue, monitoringv1alpha1.ReasonLoaded,
+			fmt.Sprintf("Prometheus loaded %d rules", len(statuses)))
+	}
+}
+
+// isPrometheusRuleFile reports whether a rule file loaded by Prometheus was generated from
+// the given PrometheusRule. Prometheus Operator names rule files <namespace>-<name>-<uid>.yaml,
+// or <namespace>-<name>.yaml in older releases.
+func isPrometheusRuleFile(file string, prometheusRule *monitoringv1.PrometheusRule) bool {
+	base := path.Base(file)
+	prefix := prometheusRule.Namespace + "-" + prometheusRule.Name
+	if base == prefix+".yaml" {
+		return true
+	}
+	return prometheusRule.UID != "" && base == prefix+"-"+string(prometheusRule.UID)+".yaml"
+}
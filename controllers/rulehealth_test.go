@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/prometheus"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+)
+
+// testScheme returns a scheme with the types the reconciler reads and writes
+func testScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, monitoringv1alpha1.AddToScheme, monitoringv1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return scheme
+}
+
+// newApplyClient returns a fake client holding objs with a status subresource for
+// AlertRules. The fake client applies patches to existing objects only, so an apply of
+// a missing object creates it with the labels owned by the field manager, as the API
+// server does.
+func newApplyClient(scheme *runtime.Scheme, objs ...client.Object) client.WithWatch {
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&monitoringv1alpha1.AlertRule{}).
+		Build()
+	return interceptor.NewClient(c, interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			existing := obj.DeepCopyObject().(client.Object)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing); errors.IsNotFound(err) {
+				labels := map[string]interface{}{}
+				for k := range obj.GetLabels() {
+					labels["f:"+k] = map[string]interface{}{}
+				}
+				fields, err := json.Marshal(map[string]interface{}{"f:metadata": map[string]interface{}{"f:labels": labels}})
+				if err != nil {
+					return err
+				}
+				obj.SetManagedFields([]metav1.ManagedFieldsEntry{{
+					Manager:   FieldManager,
+					Operation: metav1.ManagedFieldsOperationApply,
+					FieldsV1:  &metav1.FieldsV1{Raw: fields},
+				}})
+				return c.Create(ctx, obj)
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+}
+
+// rulesServer serves groups from /api/v1/rules the way Prometheus does
+func rulesServer(t *testing.T, groups []prometheus.RuleGroup) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/rules" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"groups": groups},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// healthTestAlertRule returns an AlertRule with the given groups and the PrometheusRule
+// generated for it
+func healthTestAlertRule(groups ...string) (*monitoringv1alpha1.AlertRule, *monitoringv1.PrometheusRule) {
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu", Namespace: "monitoring", Generation: 1},
+	}
+	for _, group := range groups {
+		alertRule.Spec.Groups = append(alertRule.Spec.Groups, monitoringv1alpha1.AlertGroup{
+			Name:  group,
+			Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 90"}},
+		})
+	}
+	prometheusRule := render.GeneratePrometheusRule(alertRule)
+	prometheusRule.UID = "1234"
+	return alertRule, prometheusRule
+}
+
+func TestCheckRuleHealth(t *testing.T) {
+	lastEvaluation := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	file := "/etc/prometheus/rules/prometheus-k8s-rulefiles-0/monitoring-kneutral-cpu-1234.yaml"
+
+	tests := []struct {
+		name       string
+		groups     []string
+		served     []prometheus.RuleGroup
+		wantStatus metav1.ConditionStatus
+		wantReason string
+		wantRules  []monitoringv1alpha1.RuleStatus
+	}{
+		{
+			name:   "loaded and healthy",
+			groups: []string{"cpu.rules"},
+			served: []prometheus.RuleGroup{{
+				Name: "cpu.rules",
+				File: file,
+				Rules: []prometheus.Rule{{
+					Name:           "HighCPU",
+					Health:         "ok",
+					EvaluationTime: 0.0025,
+					LastEvaluation: lastEvaluation,
+				}},
+			}},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: monitoringv1alpha1.ReasonLoaded,
+			wantRules: []monitoringv1alpha1.RuleStatus{{
+				Group:          "cpu.rules",
+				Name:           "HighCPU",
+				Health:         "ok",
+				EvaluationTime: "2.5ms",
+				LastEvaluation: &metav1.Time{Time: lastEvaluation},
+			}},
+		},
+		{
+			name:   "evaluation error",
+			groups: []string{"cpu.rules"},
+			served: []prometheus.RuleGroup{{
+				Name: "cpu.rules",
+				File: file,
+				Rules: []prometheus.Rule{{
+					Name:           "HighCPU",
+					Health:         "err",
+					LastError:      "many-to-many matching not allowed",
+					EvaluationTime: 0.5,
+				}},
+			}},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: monitoringv1alpha1.ReasonEvaluationFailed,
+			wantRules: []monitoringv1alpha1.RuleStatus{{
+				Group:          "cpu.rules",
+				Name:           "HighCPU",
+				Health:         "err",
+				LastError:      "many-to-many matching not allowed",
+				EvaluationTime: "500ms",
+			}},
+		},
+		{
+			name:       "group not loaded",
+			groups:     []string{"cpu.rules", "memory.rules"},
+			served:     []prometheus.RuleGroup{{Name: "cpu.rules", File: file, Rules: []prometheus.Rule{{Name: "HighCPU", Health: "ok"}}}},
+			wantStatus: metav1.ConditionUnknown,
+			wantReason: monitoringv1alpha1.ReasonNotLoaded,
+			wantRules:  []monitoringv1alpha1.RuleStatus{{Group: "cpu.rules", Name: "HighCPU", Health: "ok", EvaluationTime: "0s"}},
+		},
+		{
+			name:   "same group name in another file",
+			groups: []string{"cpu.rules"},
+			served: []prometheus.RuleGroup{{
+				Name:  "cpu.rules",
+				File:  "/etc/prometheus/rules/prometheus-k8s-rulefiles-0/monitoring-other-5678.yaml",
+				Rules: []prometheus.Rule{{Name: "HighCPU", Health: "err", LastError: "not ours"}},
+			}},
+			wantStatus: metav1.ConditionUnknown,
+			wantReason: monitoringv1alpha1.ReasonNotLoaded,
+			wantRules:  []monitoringv1alpha1.RuleStatus{},
+		},
+		{
+			name:   "file name without UID",
+			groups: []string{"cpu.rules"},
+			served: []prometheus.RuleGroup{{
+				Name:  "cpu.rules",
+				File:  "/etc/prometheus/rules/monitoring-kneutral-cpu.yaml",
+				Rules: []prometheus.Rule{{Name: "HighCPU", Health: "unknown"}},
+			}},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: monitoringv1alpha1.ReasonLoaded,
+			wantRules:  []monitoringv1alpha1.RuleStatus{{Group: "cpu.rules", Name: "HighCPU", Health: "unknown", EvaluationTime: "0s"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := rulesServer(t, tt.served)
+			r := &AlertRuleReconciler{Prometheus: prometheus.NewClient(server.URL, time.Minute)}
+			alertRule, prometheusRule := healthTestAlertRule(tt.groups...)
+
+			r.checkRuleHealth(context.Background(), alertRule, prometheusRule)
+
+			condition := meta.FindStatusCondition(alertRule.Status.Conditions, monitoringv1alpha1.ConditionLoadedByPrometheus)
+			if condition == nil {
+				t.Fatal("LoadedByPrometheus condition not set")
+			}
+			if condition.Status != tt.wantStatus || condition.Reason != tt.wantReason {
+				t.Errorf("LoadedByPrometheus = %s/%s (%s), want %s/%s", condition.Status, condition.Reason, condition.Message, tt.wantStatus, tt.wantReason)
+			}
+			if len(alertRule.Status.Rules) != len(tt.wantRules) {
+				t.Fatalf("status.rules = %+v, want %+v", alertRule.Status.Rules, tt.wantRules)
+			}
+			for i, got := range alertRule.Status.Rules {
+				want := tt.wantRules[i]
+				if got.Group != want.Group || got.Name != want.Name || got.Health != want.Health ||
+					got.LastError != want.LastError || got.EvaluationTime != want.EvaluationTime {
+					t.Errorf("status.rules[%d] = %+v, want %+v", i, got, want)
+				}
+				switch {
+				case want.LastEvaluation == nil && got.LastEvaluation != nil:
+					t.Errorf("status.rules[%d].lastEvaluation = %v, want none", i, got.LastEvaluation)
+				case want.LastEvaluation != nil && (got.LastEvaluation == nil || !got.LastEvaluation.Equal(want.LastEvaluation)):
+					t.Errorf("status.rules[%d].lastEvaluation = %v, want %v", i, got.LastEvaluation, want.LastEvaluation)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRuleHealthUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	r := &AlertRuleReconciler{Prometheus: prometheus.NewClient(url, time.Minute)}
+	alertRule, prometheusRule := healthTestAlertRule("cpu.rules")
+
+	r.checkRuleHealth(context.Background(), alertRule, prometheusRule)
+
+	condition := meta.FindStatusCondition(alertRule.Status.Conditions, monitoringv1alpha1.ConditionLoadedByPrometheus)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != monitoringv1alpha1.ReasonPrometheusError {
+		t.Fatalf("LoadedByPrometheus = %+v, want False/%s", condition, monitoringv1alpha1.ReasonPrometheusError)
+	}
+	if state := computeState(alertRule); state != monitoringv1alpha1.AlertRuleStateDegraded {
+		t.Errorf("state = %s, want %s", state, monitoringv1alpha1.AlertRuleStateDegraded)
+	}
+}
+
+func TestUnchangedPollKeepsResourceVersion(t *testing.T) {
+	scheme := testScheme(t)
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "cpu",
+			Namespace:  "monitoring",
+			Generation: 1,
+			Finalizers: []string{"alertrule.kneutral.io/finalizer"},
+		},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Groups: []monitoringv1alpha1.AlertGroup{{Name: "cpu.rules", Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 90"}}}},
+		},
+	}
+
+	// Prometheus evaluates the rule between polls, so its timings change every time
+	var mutex sync.Mutex
+	health, evaluations := "ok", 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		evaluations++
+		groups := []prometheus.RuleGroup{{
+			Name: "cpu.rules",
+			File: "/etc/prometheus/rules/monitoring-kneutral-cpu.yaml",
+			Rules: []prometheus.Rule{{
+				Name:           "HighCPU",
+				Health:         health,
+				EvaluationTime: float64(evaluations) / 1000,
+				LastEvaluation: time.Date(2026, 10, 16, 12, evaluations, 0, 0, time.UTC),
+			}},
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "data": map[string]interface{}{"groups": groups}})
+	}))
+	t.Cleanup(server.Close)
+
+	c := newApplyClient(scheme, alertRule)
+	r := &AlertRuleReconciler{
+		Client:                 c,
+		Scheme:                 scheme,
+		Recorder:               record.NewFakeRecorder(100),
+		Prometheus:             prometheus.NewClient(server.URL, 0),
+		PrometheusPollInterval: time.Minute,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "monitoring", Name: "cpu"}}
+
+	reconcile := func() *monitoringv1alpha1.AlertRule {
+		t.Helper()
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		got := &monitoringv1alpha1.AlertRule{}
+		if err := c.Get(context.Background(), req.NamespacedName, got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// The first reconcile creates the PrometheusRule and the next finds it unchanged,
+	// which is reported once; every poll after that finds nothing new
+	reconcile()
+	first := reconcile()
+	if first.Status.State != monitoringv1alpha1.AlertRuleStateActive || first.Status.LastReconcileTime == nil {
+		t.Fatalf("status after the first reconcile = %+v, want Active with a reconcile time", first.Status)
+	}
+
+	for i := 0; i < 2; i++ {
+		if polled := reconcile(); polled.ResourceVersion != first.ResourceVersion {
+			t.Errorf("poll %d changed resourceVersion from %s to %s without a status change", i, first.ResourceVersion, polled.ResourceVersion)
+		}
+	}
+
+	mutex.Lock()
+	health = "err"
+	mutex.Unlock()
+	changed := reconcile()
+	if changed.ResourceVersion == first.ResourceVersion {
+		t.Error("status not written after the rule started failing")
+	}
+	if changed.Status.State != monitoringv1alpha1.AlertRuleStateDegraded || changed.Status.Rules[0].Health != "err" {
+		t.Errorf("status = %+v, want Degraded with the failing rule", changed.Status)
+	}
+}
@@ -57,4 +57,11 @@ Create the name of the service account to use
 {{- else }}
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
-{{- end }}
\ No newline at end of file
+{{- end }}
+
+{{/*
+Create the name of the webhook serving certificate secret
+*/}}
+{{- define "kneutral-operator.webhookCertSecretName" -}}
+{{- default (printf "%s-webhook-server-cert" (include "kneutral-operator.fullname" .)) .Values.webhook.certSecretName }}
+{{- end }}
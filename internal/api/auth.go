@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// APIKeyUserPrefix is prepended to the name of an API key to form the user name of its caller
+const APIKeyUserPrefix = "kneutral:apikey:"
+
+// APIKeyGroup is the group every API key caller belongs to
+const APIKeyGroup = "kneutral:apikeys"
+
+// Authenticator identifies the caller of an API request
+type Authenticator interface {
+	// Authenticate returns the caller of the request. ok is false when the request
+	// carries no credentials the authenticator accepts.
+	Authenticate(ctx context.Context, r *http.Request) (user *authenticationv1.UserInfo, ok bool, err error)
+}
+
+// Authenticators tries each Authenticator in order and returns the first caller identified
+type Authenticators []Authenticator
+
+// Authenticate implements Authenticator. Errors are only returned when no authenticator
+// accepted the request.
+func (a Authenticators) Authenticate(ctx context.Context, r *http.Request) (*authenticationv1.UserInfo, bool, error) {
+	var errs []error
+	for _, authenticator := range a {
+		user, ok, err := authenticator.Authenticate(ctx, r)
+		if ok {
+			return user, true, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return nil, false, utilerrors.NewAggregate(errs)
+}
+
+// userKey is the context key of the authenticated caller
+type userKey struct{}
+
+// withUser returns a copy of ctx carrying the authenticated caller
+func withUser(ctx context.Context, user *authenticationv1.UserInfo) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the authenticated caller of a request, if any
+func UserFrom(ctx context.Context) (*authenticationv1.UserInfo, bool) {
+	user, ok := ctx.Value(userKey{}).(*authenticationv1.UserInfo)
+	return user, ok
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// rejectedTokenTTL is how long a token that failed review is rejected without asking
+// the API server again
+const rejectedTokenTTL = 10 * time.Second
+
+// isJWT reports whether token has the shape of a JSON Web Token: three base64url
+// encoded parts separated by dots
+func isJWT(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenReviewAuthenticator validates bearer tokens with the Kubernetes TokenReview API.
+// Only JWTs, as ServiceAccount and OIDC tokens are, are sent for review.
+type TokenReviewAuthenticator struct {
+	client    client.Client
+	audiences []string
+	cacheTTL  time.Duration
+
+	mutex sync.Mutex
+	cache map[[sha256.Size]byte]cachedUser
+}
+
+// cachedUser is a token review kept until expires. A nil user is a token that failed
+// review.
+type cachedUser struct {
+	user    *authenticationv1.UserInfo
+	expires time.Time
+}
+
+// NewTokenReviewAuthenticator creates a TokenReviewAuthenticator. Tokens that pass review
+// are cached for cacheTTL so a client making many requests costs one TokenReview; tokens
+// that fail it are rejected for a few seconds without another review.
+func NewTokenReviewAuthenticator(c client.Client, audiences []string, cacheTTL time.Duration) *TokenReviewAuthenticator {
+	return &TokenReviewAuthenticator{
+		client:    c,
+		audiences: audiences,
+		cacheTTL:  cacheTTL,
+		cache:     map[[sha256.Size]byte]cachedUser{},
+	}
+}
+
+// Authenticate implements Authenticator
+func (a *TokenReviewAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*authenticationv1.UserInfo, bool, error) {
+	token := bearerToken(r)
+	// API keys and other opaque tokens are left to the next authenticator rather than
+	// costing a TokenReview each
+	if token == "" || !isJWT(token) {
+		return nil, false, nil
+	}
+
+	// Only a hash of the token is kept in memory
+	key := sha256.Sum256([]byte(token))
+	a.mutex.Lock()
+	cached, found := a.cache[key]
+	a.mutex.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.user, cached.user != nil, nil
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.audiences,
+		},
+	}
+	if err := a.client.Create(ctx, review); err != nil {
+		return nil, false, fmt.Errorf("token review failed: %w", err)
+	}
+	if !review.Status.Authenticated {
+		a.store(key, nil, min(rejectedTokenTTL, a.cacheTTL))
+		return nil, false, nil
+	}
+
+	user := review.Status.User
+	a.store(key, &user, a.cacheTTL)
+	return &user, true, nil
+}
+
+// store caches the review of a token for ttl, dropping expired entries
+func (a *TokenReviewAuthenticator) store(key [sha256.Size]byte, user *authenticationv1.UserInfo, ttl time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	now := time.Now()
+	for k, v := range a.cache {
+		if now.After(v.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = cachedUser{user: user, expires: now.Add(ttl)}
+}
+
+// APIKeyAuthenticator authenticates static API keys stored in a Secret. Each entry of
+// the Secret maps a key name to the API key; callers are identified as
+// kneutral:apikey:<name> in the kneutral:apikeys group. Keys are accepted as a bearer
+// token or in the X-API-Key header.
+type APIKeyAuthenticator struct {
+	reader  client.Reader
+	secret  types.NamespacedName
+	refresh time.Duration
+
+	mutex  sync.Mutex
+	keys   map[string][]byte
+	loaded time.Time
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator that re-reads the Secret at
+// most every refresh, so rotated keys are picked up without a restart
+func NewAPIKeyAuthenticator(reader client.Reader, secret types.NamespacedName, refresh time.Duration) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		reader:  reader,
+		secret:  secret,
+		refresh: refresh,
+	}
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*authenticationv1.UserInfo, bool, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = bearerToken(r)
+	}
+	if key == "" {
+		return nil, false, nil
+	}
+
+	keys, err := a.loadKeys(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for name, value := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), value) == 1 {
+			return &authenticationv1.UserInfo{
+				Username: APIKeyUserPrefix + name,
+				Groups:   []string{APIKeyGroup},
+			}, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// loadKeys returns the API keys, reading the Secret again once the refresh interval passed
+func (a *APIKeyAuthenticator) loadKeys(ctx context.Context) (map[string][]byte, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.keys != nil && time.Since(a.loaded) < a.refresh {
+		return a.keys, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := a.reader.Get(ctx, a.secret, secret); err != nil {
+		// Keep serving the last keys that were read rather than locking everyone out
+		if a.keys != nil {
+			return a.keys, nil
+		}
+		return nil, fmt.Errorf("failed to read API keys from secret %s: %w", a.secret, err)
+	}
+
+	keys := map[string][]byte{}
+	for name, value := range secret.Data {
+		// Empty values would match nothing useful and are most likely a mistake
+		if len(value) > 0 {
+			keys[name] = value
+		}
+	}
+	a.keys = keys
+	a.loaded = time.Now()
+	return a.keys, nil
+}
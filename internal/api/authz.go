@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// alertRulesResource is the resource most API requests are authorized against
+var alertRulesResource = schema.GroupResource{Group: monitoringv1alpha1.GroupVersion.Group, Resource: "alertrules"}
+
+// eventsResource is the resource the events sub-path is authorized against
+var eventsResource = schema.GroupResource{Group: "", Resource: "events"}
+
+// prometheusRulesResource is the resource a preview is authorized against before it
+// reads the live PrometheusRule
+var prometheusRulesResource = schema.GroupResource{Group: monitoringv1.SchemeGroupVersion.Group, Resource: "prometheusrules"}
+
+// Authorizer decides whether the caller of an API request may perform it
+type Authorizer interface {
+	// Authorize returns whether user may perform the action described by attrs, and
+	// the reason given by the authorizer, if any
+	Authorize(ctx context.Context, user *authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (allowed bool, reason string, err error)
+}
+
+// SubjectAccessReviewAuthorizer authorizes callers against the cluster's RBAC with
+// SubjectAccessReviews, so API callers need the same permissions as kubectl users
+type SubjectAccessReviewAuthorizer struct {
+	client client.Client
+}
+
+// NewSubjectAccessReviewAuthorizer creates a SubjectAccessReviewAuthorizer
+func NewSubjectAccessReviewAuthorizer(c client.Client) *SubjectAccessReviewAuthorizer {
+	return &SubjectAccessReviewAuthorizer{client: c}
+}
+
+// Authorize implements Authorizer
+func (a *SubjectAccessReviewAuthorizer) Authorize(ctx context.Context, user *authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}
+	if err := a.client.Create(ctx, review); err != nil {
+		return false, "", fmt.Errorf("subject access review failed: %w", err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// SetAuthorizer makes every handler check that the authenticated caller may perform
+// the request. It only takes effect together with an Authenticator.
+func (s *Server) SetAuthorizer(a Authorizer) {
+	s.authorizer = a
+}
+
+// authorize checks that the caller of r may perform verb on the resource and writes
+// a 403 Status response if not. It returns whether the handler may continue.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, verb string, resource schema.GroupResource, namespace, name string) bool {
+	if err := s.checkAccess(r, verb, resource, namespace, name); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// checkAccess returns a Forbidden error if the caller of r may not perform verb on the
+// resource, for requests such as batches that authorize more than one action
+func (s *Server) checkAccess(r *http.Request, verb string, resource schema.GroupResource, namespace, name string) error {
+	if s.authorizer == nil {
+		return nil
+	}
+
+	user, ok := UserFrom(r.Context())
+	if !ok {
+		// The auth middleware runs first, so this only happens without an Authenticator
+		return nil
+	}
+
+	attrs := authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      verb,
+		Group:     resource.Group,
+		Resource:  resource.Resource,
+		Name:      name,
+	}
+	if resource == alertRulesResource {
+		attrs.Version = monitoringv1alpha1.GroupVersion.Version
+	}
+
+	allowed, reason, err := s.authorizer.Authorize(r.Context(), user, attrs)
+	if err != nil {
+		s.logFor(r).Error(err, "Failed to authorize request", "user", user.Username, "verb", verb, "namespace", namespace, "name", name)
+		return err
+	}
+	if allowed {
+		return nil
+	}
+
+	// Same wording as the Kubernetes API server, so the message is familiar from kubectl
+	message := fmt.Sprintf("User %q cannot %s resource %q in API group %q", user.Username, verb, resource.Resource, resource.Group)
+	if namespace != "" {
+		message += fmt.Sprintf(" in the namespace %q", namespace)
+	} else {
+		message += " at the cluster scope"
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+	return apierrors.NewForbidden(resource, name, fmt.Errorf("%s", message))
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// staticAuthenticator identifies every request as user
+type staticAuthenticator struct {
+	user authenticationv1.UserInfo
+}
+
+func (a staticAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*authenticationv1.UserInfo, bool, error) {
+	return &a.user, true, nil
+}
+
+// permissions allows the "verb resource" pairs it holds, in any namespace
+type permissions map[string]bool
+
+func (p permissions) Authorize(ctx context.Context, user *authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	return p[attrs.Verb+" "+attrs.Resource], "", nil
+}
+
+// newAuthorizedTestServer returns a test server whose caller has only the given permissions
+func newAuthorizedTestServer(t *testing.T, allowed permissions) *Server {
+	t.Helper()
+	s, _ := newTestServer(t)
+	s.SetAuthenticator(staticAuthenticator{user: authenticationv1.UserInfo{Username: "alice"}})
+	s.SetAuthorizer(allowed)
+	return s
+}
+
+func TestAlertRuleEventsAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  permissions
+		path     string
+		wantCode int
+	}{
+		{name: "list events and get alertrule", allowed: permissions{"list events": true, "get alertrules": true}, path: "cpu-monitoring", wantCode: http.StatusOK},
+		{name: "list events only", allowed: permissions{"list events": true}, path: "cpu-monitoring", wantCode: http.StatusForbidden},
+		{name: "get alertrule only", allowed: permissions{"get alertrules": true}, path: "cpu-monitoring", wantCode: http.StatusForbidden},
+		{name: "missing alertrule without get", allowed: permissions{"list events": true}, path: "missing", wantCode: http.StatusForbidden},
+		{name: "missing alertrule", allowed: permissions{"list events": true, "get alertrules": true}, path: "missing", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAuthorizedTestServer(t, tt.allowed)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/monitoring/alertrules/"+tt.path+"/events", nil)
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,494 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
+)
+
+// Batch operations
+const (
+	BatchOpCreate = "create"
+	BatchOpUpsert = "upsert"
+	BatchOpDelete = "delete"
+)
+
+// Batch operation results
+const (
+	// BatchSucceeded operations were applied, or would have been in a dry run
+	BatchSucceeded = "Succeeded"
+	// BatchFailed operations weren't applied
+	BatchFailed = "Failed"
+	// BatchSkipped operations of an atomic batch didn't run because another one failed
+	BatchSkipped = "Skipped"
+	// BatchRolledBack operations of an atomic batch were applied and then undone
+	BatchRolledBack = "RolledBack"
+	// BatchRollbackFailed operations of an atomic batch were applied but couldn't be undone
+	BatchRollbackFailed = "RollbackFailed"
+)
+
+const (
+	// defaultBatchConcurrency is how many operations of a batch run at once by default
+	defaultBatchConcurrency = 10
+	// maxBatchConcurrency bounds the concurrency a batch can ask for
+	maxBatchConcurrency = 50
+	// maxBatchOperations bounds the number of operations in a batch
+	maxBatchOperations = 1000
+)
+
+// BatchRequest is a list of operations on AlertRules in any namespace
+type BatchRequest struct {
+	// Operations run concurrently, so no two may name the same AlertRule
+	Operations []BatchOperation `json:"operations"`
+
+	// Atomic makes the batch all-or-nothing: if an operation fails, the ones already
+	// applied are rolled back and the rest are skipped. An atomic batch can't delete.
+	Atomic bool `json:"atomic,omitempty"`
+
+	// Concurrency is how many operations run at once, at most 50. 0 runs the default of 10.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// BatchOperation creates, upserts or deletes one AlertRule
+type BatchOperation struct {
+	// Op is create, upsert or delete
+	Op string `json:"op"`
+
+	// Namespace and Name of the AlertRule, by default those in the AlertRule's metadata
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+
+	// AlertRule to create, or whose spec an upsert applies. Deletes don't need one.
+	AlertRule *monitoringv1alpha1.AlertRule `json:"alertRule,omitempty"`
+}
+
+// BatchResult is the outcome of the operation at the same index
+type BatchResult struct {
+	Op        string `json:"op"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// Result is Succeeded, Failed, Skipped, RolledBack or RollbackFailed
+	Result string `json:"result"`
+
+	// Code is the HTTP status code the operation would have got on its own
+	Code int32 `json:"code,omitempty"`
+
+	// Status explains why the operation or its rollback failed
+	Status *metav1.Status `json:"status,omitempty"`
+
+	// AlertRule is the AlertRule as created or updated
+	AlertRule *monitoringv1alpha1.AlertRule `json:"alertRule,omitempty"`
+}
+
+// BatchResponse reports the outcome of every operation of a batch
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+
+	// RolledBack is set when an operation of an atomic batch failed, so nothing was kept
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// batchItem is an operation of a batch while it runs
+type batchItem struct {
+	op     BatchOperation
+	result *BatchResult
+
+	// desired is the AlertRule a create or upsert writes
+	desired *monitoringv1alpha1.AlertRule
+	// existing is the AlertRule before the operation, nil if there was none
+	existing *monitoringv1alpha1.AlertRule
+	// applied is the AlertRule a create or upsert wrote
+	applied *monitoringv1alpha1.AlertRule
+}
+
+// succeed records that the operation was applied
+func (item *batchItem) succeed(code int32) bool {
+	item.result.Result = BatchSucceeded
+	item.result.Code = code
+	item.result.AlertRule = item.applied
+	return true
+}
+
+// fail records why the operation wasn't applied
+func (item *batchItem) fail(err error) bool {
+	status := apiStatus(err)
+	item.result.Result = BatchFailed
+	item.result.Code = status.Code
+	item.result.Status = &status
+	return false
+}
+
+// batchAlertRules runs a batch of create, upsert and delete operations across
+// namespaces, up to its concurrency at a time, and reports the outcome of each. Every
+// operation is authorized on its own. All operations are checked before any is applied,
+// so an atomic batch writes nothing if one is forbidden or invalid. An atomic batch rolls
+// back what it applied if an operation fails. It can't hold deletes, since a deleted
+// AlertRule stays terminating until the controller has removed its finalizer and can't
+// be created again meanwhile.
+func (s *Server) batchAlertRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var batch BatchRequest
+	if err := decodeBody(r, &batch); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	items, errs := newBatchItems(&batch)
+	if len(errs) > 0 {
+		writeError(w, r, newInvalid("", errs))
+		return
+	}
+	concurrency := batch.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	// Authorize and validate every operation, and read what it changes
+	runBatch(items, concurrency, false, func(item *batchItem) bool {
+		return s.checkBatchItem(ctx, r, item)
+	})
+
+	response := &BatchResponse{Results: make([]BatchResult, 0, len(items))}
+	if !batch.Atomic {
+		runBatch(pending(items), concurrency, false, func(item *batchItem) bool {
+			return s.applyBatchItem(ctx, r, item, dryRun)
+		})
+	} else if !anyFailed(items) {
+		runBatch(pending(items), concurrency, true, func(item *batchItem) bool {
+			return s.applyBatchItem(ctx, r, item, dryRun)
+		})
+	}
+
+	if batch.Atomic && anyFailed(items) {
+		response.RolledBack = true
+		// The rollback finishes even if the caller has gone away
+		rollbackCtx := context.WithoutCancel(ctx)
+		var applied []*batchItem
+		for _, item := range items {
+			if item.result.Result == BatchSucceeded {
+				applied = append(applied, item)
+			}
+		}
+		runBatch(applied, concurrency, false, func(item *batchItem) bool {
+			return s.rollbackBatchItem(rollbackCtx, r, item, dryRun)
+		})
+		for _, item := range pending(items) {
+			item.result.Result = BatchSkipped
+		}
+	}
+
+	for _, item := range items {
+		switch item.result.Result {
+		case BatchSucceeded:
+			response.Succeeded++
+		case BatchFailed:
+			response.Failed++
+		}
+		response.Results = append(response.Results, *item.result)
+	}
+
+	s.writeObject(w, r, http.StatusOK, response)
+}
+
+// newBatchItems checks the shape of a batch and resolves the AlertRule each operation
+// names. Problems with the batch itself fail the whole request; those of an AlertRule's
+// spec only fail its operation.
+func newBatchItems(batch *BatchRequest) ([]*batchItem, field.ErrorList) {
+	var errs field.ErrorList
+	if batch.Concurrency < 0 || batch.Concurrency > maxBatchConcurrency {
+		errs = append(errs, field.Invalid(field.NewPath("concurrency"), batch.Concurrency,
+			fmt.Sprintf("must be between 1 and %d, or 0 for the default of %d", maxBatchConcurrency, defaultBatchConcurrency)))
+	}
+	operationsPath := field.NewPath("operations")
+	if len(batch.Operations) == 0 {
+		errs = append(errs, field.Required(operationsPath, ""))
+	}
+	if len(batch.Operations) > maxBatchOperations {
+		errs = append(errs, field.TooMany(operationsPath, len(batch.Operations), maxBatchOperations))
+		return nil, errs
+	}
+
+	items := make([]*batchItem, 0, len(batch.Operations))
+	seen := map[types.NamespacedName]bool{}
+	for i, op := range batch.Operations {
+		path := operationsPath.Index(i)
+		item := &batchItem{op: op, result: &BatchResult{Op: op.Op, Namespace: op.Namespace, Name: op.Name}}
+		items = append(items, item)
+
+		switch op.Op {
+		case BatchOpCreate, BatchOpUpsert:
+			if op.AlertRule == nil {
+				errs = append(errs, field.Required(path.Child("alertRule"), fmt.Sprintf("%s needs an AlertRule", op.Op)))
+				continue
+			}
+		case BatchOpDelete:
+			if batch.Atomic {
+				errs = append(errs, field.Forbidden(path.Child("op"), "an atomic batch can't delete, since a deleted AlertRule can't be restored while it is terminating"))
+				continue
+			}
+		default:
+			errs = append(errs, field.NotSupported(path.Child("op"), op.Op, []string{BatchOpCreate, BatchOpUpsert, BatchOpDelete}))
+			continue
+		}
+
+		if op.AlertRule != nil {
+			if item.result.Namespace == "" {
+				item.result.Namespace = op.AlertRule.Namespace
+			} else if op.AlertRule.Namespace != "" && op.AlertRule.Namespace != item.result.Namespace {
+				errs = append(errs, field.Invalid(path.Child("alertRule", "metadata", "namespace"), op.AlertRule.Namespace,
+					"doesn't match the operation's namespace"))
+			}
+			if item.result.Name == "" {
+				item.result.Name = op.AlertRule.Name
+			} else if op.AlertRule.Name != "" && op.AlertRule.Name != item.result.Name {
+				errs = append(errs, field.Invalid(path.Child("alertRule", "metadata", "name"), op.AlertRule.Name,
+					"doesn't match the operation's name"))
+			}
+		}
+		if item.result.Namespace == "" {
+			errs = append(errs, field.Required(path.Child("namespace"), ""))
+		}
+		if item.result.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		}
+
+		key := types.NamespacedName{Namespace: item.result.Namespace, Name: item.result.Name}
+		if seen[key] {
+			errs = append(errs, field.Duplicate(path, key.String()))
+		}
+		seen[key] = true
+
+		if op.AlertRule != nil && op.Op != BatchOpDelete {
+			item.desired = op.AlertRule.DeepCopy()
+			item.desired.Namespace = key.Namespace
+			item.desired.Name = key.Name
+			if item.desired.TypeMeta.Kind == "" {
+				item.desired.TypeMeta = metav1.TypeMeta{
+					APIVersion: monitoringv1alpha1.GroupVersion.String(),
+					Kind:       "AlertRule",
+				}
+			}
+		}
+	}
+	return items, errs
+}
+
+// checkBatchItem authorizes and validates an operation and reads the AlertRule it
+// changes, failing the operation if it can't succeed. The operation is authorized before
+// the AlertRule is read, so a forbidden one can't tell whether it exists. An upsert needs
+// update, and create as well if the AlertRule doesn't exist.
+func (s *Server) checkBatchItem(ctx context.Context, r *http.Request, item *batchItem) bool {
+	namespace, name := item.result.Namespace, item.result.Name
+
+	var err error
+	switch item.op.Op {
+	case BatchOpDelete:
+		err = s.checkAccess(r, "delete", alertRulesResource, namespace, name)
+	case BatchOpCreate:
+		err = s.checkAccess(r, "create", alertRulesResource, namespace, "")
+	default:
+		err = s.checkAccess(r, "update", alertRulesResource, namespace, name)
+	}
+	if err != nil {
+		return item.fail(err)
+	}
+
+	existing := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule", "namespace", namespace, "name", name)
+			return item.fail(err)
+		}
+		existing = nil
+	}
+	item.existing = existing
+
+	switch {
+	case item.op.Op == BatchOpCreate && existing != nil:
+		return item.fail(apierrors.NewAlreadyExists(alertRulesResource, name))
+	case item.op.Op == BatchOpUpsert && existing == nil && item.desired.ResourceVersion == "":
+		if err := s.checkAccess(r, "create", alertRulesResource, namespace, ""); err != nil {
+			return item.fail(err)
+		}
+	}
+
+	// A delete, or an upsert conditional on a resourceVersion, needs the AlertRule to exist
+	if existing == nil && (item.op.Op == BatchOpDelete || item.desired.ResourceVersion != "") {
+		return item.fail(apierrors.NewNotFound(alertRulesResource, name))
+	}
+	if item.op.Op == BatchOpDelete {
+		return true
+	}
+
+	validation.SetDefaults(&item.desired.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&item.desired.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&item.desired.Spec), metrics.SourceAPI).Inc()
+		return item.fail(newInvalid(name, errs))
+	}
+	return true
+}
+
+// applyBatchItem applies a checked operation. An upsert of an existing AlertRule
+// replaces its spec, as a PUT does, guarded by the resourceVersion read when it was
+// checked.
+func (s *Server) applyBatchItem(ctx context.Context, r *http.Request, item *batchItem, dryRun bool) bool {
+	switch {
+	case item.op.Op == BatchOpDelete:
+		opts := []client.DeleteOption{client.Preconditions{UID: &item.existing.UID, ResourceVersion: &item.existing.ResourceVersion}}
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		if err := s.client.Delete(ctx, item.existing.DeepCopy(), opts...); err != nil {
+			if !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				s.logFor(r).Error(err, "Failed to delete AlertRule", "namespace", item.result.Namespace, "name", item.result.Name)
+			}
+			return item.fail(err)
+		}
+		return item.succeed(http.StatusNoContent)
+
+	case item.existing == nil:
+		created := item.desired.DeepCopy()
+		created.ResourceVersion = ""
+		var opts []client.CreateOption
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		if err := s.client.Create(ctx, created, opts...); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				s.logFor(r).Error(err, "Failed to create AlertRule", "namespace", item.result.Namespace, "name", item.result.Name)
+			}
+			return item.fail(err)
+		}
+		item.applied = created
+		return item.succeed(http.StatusCreated)
+
+	default:
+		updated := item.existing.DeepCopy()
+		updated.Spec = item.desired.Spec
+		if item.desired.ResourceVersion != "" {
+			updated.ResourceVersion = item.desired.ResourceVersion
+		}
+		var opts []client.UpdateOption
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		if err := s.client.Update(ctx, updated, opts...); err != nil {
+			if !apierrors.IsConflict(err) && !apierrors.IsNotFound(err) {
+				s.logFor(r).Error(err, "Failed to update AlertRule", "namespace", item.result.Namespace, "name", item.result.Name)
+			}
+			return item.fail(err)
+		}
+		item.applied = updated
+		return item.succeed(http.StatusOK)
+	}
+}
+
+// rollbackBatchItem undoes an applied operation of a failed atomic batch. A created
+// AlertRule is deleted and an updated one gets its old spec back, unless someone else
+// changed it since. A dry run had nothing applied.
+func (s *Server) rollbackBatchItem(ctx context.Context, r *http.Request, item *batchItem, dryRun bool) bool {
+	item.result.Result = BatchRolledBack
+	item.result.AlertRule = nil
+	if dryRun {
+		return true
+	}
+
+	err := s.undoBatchItem(ctx, item)
+	if err == nil {
+		return true
+	}
+	s.logFor(r).Error(err, "Failed to roll back batch operation", "op", item.op.Op, "namespace", item.result.Namespace, "name", item.result.Name)
+	status := apiStatus(err)
+	item.result.Result = BatchRollbackFailed
+	item.result.Status = &status
+	return false
+}
+
+// undoBatchItem restores the AlertRule an operation changed
+func (s *Server) undoBatchItem(ctx context.Context, item *batchItem) error {
+	// The operator writes the status of what was applied, so changes by others are
+	// told apart by the generation, which only the spec and metadata bump
+	current := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(ctx, client.ObjectKeyFromObject(item.applied), current); err != nil {
+		return err
+	}
+	if current.UID != item.applied.UID || current.Generation != item.applied.Generation {
+		return apierrors.NewConflict(alertRulesResource, current.Name,
+			fmt.Errorf("the AlertRule was changed after the batch applied it"))
+	}
+
+	if item.existing == nil {
+		return s.client.Delete(ctx, current, client.Preconditions{UID: &current.UID, ResourceVersion: &current.ResourceVersion})
+	}
+	current.Spec = item.existing.Spec
+	return s.client.Update(ctx, current)
+}
+
+// runBatch calls fn for each item, concurrency at a time. With stopOnFailure, no more
+// calls start once one has failed. It returns whether any call failed.
+func runBatch(items []*batchItem, concurrency int, stopOnFailure bool, fn func(*batchItem) bool) bool {
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+	slots := make(chan struct{}, concurrency)
+	for _, item := range items {
+		slots <- struct{}{}
+		if stopOnFailure && failed.Load() {
+			break
+		}
+		wg.Add(1)
+		go func(item *batchItem) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if !fn(item) {
+				failed.Store(true)
+			}
+		}(item)
+	}
+	wg.Wait()
+	return failed.Load()
+}
+
+// pending returns the items without a result
+func pending(items []*batchItem) []*batchItem {
+	var unfinished []*batchItem
+	for _, item := range items {
+		if item.result.Result == "" {
+			unfinished = append(unfinished, item)
+		}
+	}
+	return unfinished
+}
+
+// anyFailed reports whether an operation failed
+func anyFailed(items []*batchItem) bool {
+	for _, item := range items {
+		if item.result.Result == BatchFailed {
+			return true
+		}
+	}
+	return false
+}
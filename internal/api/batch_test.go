@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/mock"
+)
+
+const batchTestPath = "/api/v1/alertrules:batch"
+
+// batchClient fails the creates of AlertRules named fail, after their checks passed,
+// and counts the reads of AlertRules
+type batchClient struct {
+	*mock.MockClient
+	gets atomic.Int32
+}
+
+func (c *batchClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	c.gets.Add(1)
+	return c.MockClient.Get(ctx, key, obj, opts...)
+}
+
+func (c *batchClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if obj.GetName() == "fail" {
+		return errors.New("storage unavailable")
+	}
+	return c.MockClient.Create(ctx, obj, opts...)
+}
+
+// newBatchTestServer returns a server backed by a batchClient holding the example
+// AlertRules, with the caller allowed what allowed holds, or anything if it is nil
+func newBatchTestServer(t *testing.T, allowed permissions) (*Server, *batchClient) {
+	t.Helper()
+	c := &batchClient{MockClient: mock.NewMockClient()}
+	mock.PopulateExampleData(c.MockClient)
+	s := NewServer(c, "")
+	if allowed != nil {
+		s.SetAuthenticator(staticAuthenticator{user: authenticationv1.UserInfo{Username: "alice"}})
+		s.SetAuthorizer(allowed)
+	}
+	return s, c
+}
+
+// batchCreate returns a create operation for a valid AlertRule
+func batchCreate(namespace, name string) BatchOperation {
+	return BatchOperation{Op: BatchOpCreate, AlertRule: batchAlertRule(namespace, name, "cpu > 80")}
+}
+
+// batchUpsert returns an upsert operation for a valid AlertRule with expr
+func batchUpsert(namespace, name, expr string) BatchOperation {
+	return BatchOperation{Op: BatchOpUpsert, AlertRule: batchAlertRule(namespace, name, expr)}
+}
+
+func batchAlertRule(namespace, name, expr string) *monitoringv1alpha1.AlertRule {
+	return &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Groups: []monitoringv1alpha1.AlertGroup{{Name: "cpu.rules", Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: expr}}}},
+		},
+	}
+}
+
+// runBatchRequest posts batch and decodes the response, which must be 200
+func runBatchRequest(t *testing.T, s *Server, batch BatchRequest) *BatchResponse {
+	t.Helper()
+	body, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(s, http.MethodPost, batchTestPath, string(body), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	response := &BatchResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// resultsOf returns the result of every operation, in order
+func resultsOf(response *BatchResponse) []string {
+	var results []string
+	for _, result := range response.Results {
+		results = append(results, result.Result)
+	}
+	return results
+}
+
+func TestRunBatchConcurrency(t *testing.T) {
+	for _, concurrency := range []int{1, 3, 10} {
+		var (
+			mu            sync.Mutex
+			running, peak int
+			calls         atomic.Int32
+			items         []*batchItem
+		)
+		for i := 0; i < 30; i++ {
+			items = append(items, &batchItem{result: &BatchResult{}})
+		}
+
+		runBatch(items, concurrency, false, func(*batchItem) bool {
+			calls.Add(1)
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return true
+		})
+
+		if calls.Load() != 30 {
+			t.Errorf("concurrency %d: %d calls, want 30", concurrency, calls.Load())
+		}
+		if peak > concurrency || (concurrency > 1 && peak < 2) {
+			t.Errorf("concurrency %d: up to %d calls ran at once", concurrency, peak)
+		}
+	}
+}
+
+func TestRunBatchStopOnFailure(t *testing.T) {
+	var items []*batchItem
+	for i := 0; i < 10; i++ {
+		items = append(items, &batchItem{result: &BatchResult{}})
+	}
+
+	var calls atomic.Int32
+	failed := runBatch(items, 1, true, func(*batchItem) bool {
+		return calls.Add(1) != 3
+	})
+
+	if !failed || calls.Load() != 3 {
+		t.Errorf("failed = %v after %d calls, want a failure after 3", failed, calls.Load())
+	}
+}
+
+func TestBatchAtomicRollback(t *testing.T) {
+	s, c := newBatchTestServer(t, nil)
+	before := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "cpu-monitoring"}, before); err != nil {
+		t.Fatal(err)
+	}
+
+	// One at a time, so the operations after the failing one are skipped
+	response := runBatchRequest(t, s, BatchRequest{
+		Atomic:      true,
+		Concurrency: 1,
+		Operations: []BatchOperation{
+			batchCreate("monitoring", "disk-alerts"),
+			batchUpsert("monitoring", "cpu-monitoring", "cpu > 95"),
+			batchCreate("monitoring", "fail"),
+			batchCreate("monitoring", "memory-alerts"),
+		},
+	})
+
+	want := []string{BatchRolledBack, BatchRolledBack, BatchFailed, BatchSkipped}
+	if got := resultsOf(response); !reflect.DeepEqual(got, want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	if !response.RolledBack || response.Succeeded != 0 || response.Failed != 1 {
+		t.Errorf("rolledBack %v, succeeded %d, failed %d, want true, 0, 1", response.RolledBack, response.Succeeded, response.Failed)
+	}
+	if code := response.Results[2].Code; code != http.StatusInternalServerError {
+		t.Errorf("failed operation code = %d, want 500", code)
+	}
+
+	for _, name := range []string{"disk-alerts", "memory-alerts"} {
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: name}, &monitoringv1alpha1.AlertRule{})
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("%s: err = %v, want NotFound after the rollback", name, err)
+		}
+	}
+	after := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "cpu-monitoring"}, after); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := after.Spec.Groups[0].Rules[0].Expr, before.Spec.Groups[0].Rules[0].Expr; got != want {
+		t.Errorf("expr after the rollback = %q, want %q", got, want)
+	}
+}
+
+func TestBatchNotAtomic(t *testing.T) {
+	s, c := newBatchTestServer(t, nil)
+
+	response := runBatchRequest(t, s, BatchRequest{
+		Operations: []BatchOperation{
+			batchCreate("monitoring", "disk-alerts"),
+			batchCreate("monitoring", "fail"),
+			{Op: BatchOpDelete, Namespace: "network", Name: "arista-dom-monitoring"},
+		},
+	})
+
+	want := []string{BatchSucceeded, BatchFailed, BatchSucceeded}
+	if got := resultsOf(response); !reflect.DeepEqual(got, want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "disk-alerts"}, &monitoringv1alpha1.AlertRule{}); err != nil {
+		t.Errorf("created AlertRule not kept: %v", err)
+	}
+}
+
+func TestBatchAtomicDelete(t *testing.T) {
+	s, c := newBatchTestServer(t, nil)
+
+	body, err := json.Marshal(BatchRequest{
+		Atomic: true,
+		Operations: []BatchOperation{
+			batchCreate("monitoring", "disk-alerts"),
+			{Op: BatchOpDelete, Namespace: "network", Name: "arista-dom-monitoring"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(s, http.MethodPost, batchTestPath, string(body), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("code = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	status := decodeStatus(t, rec)
+	if status.Reason != metav1.StatusReasonInvalid || status.Details == nil || len(status.Details.Causes) != 1 ||
+		status.Details.Causes[0].Field != "operations[1].op" {
+		t.Errorf("status = %+v, want Invalid with a cause for operations[1].op", status)
+	}
+
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "network", Name: "arista-dom-monitoring"}, &monitoringv1alpha1.AlertRule{}); err != nil {
+		t.Errorf("AlertRule deleted by a rejected batch: %v", err)
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "disk-alerts"}, &monitoringv1alpha1.AlertRule{}); !apierrors.IsNotFound(err) {
+		t.Errorf("AlertRule created by a rejected batch: %v", err)
+	}
+}
+
+func TestBatchAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  permissions
+		op       BatchOperation
+		wantCode int32
+		wantRead bool
+	}{
+		{name: "delete existing forbidden", allowed: permissions{}, op: BatchOperation{Op: BatchOpDelete, Namespace: "monitoring", Name: "cpu-monitoring"}, wantCode: http.StatusForbidden},
+		{name: "delete missing forbidden", allowed: permissions{}, op: BatchOperation{Op: BatchOpDelete, Namespace: "monitoring", Name: "missing"}, wantCode: http.StatusForbidden},
+		{name: "delete missing", allowed: permissions{"delete alertrules": true}, op: BatchOperation{Op: BatchOpDelete, Namespace: "monitoring", Name: "missing"}, wantCode: http.StatusNotFound, wantRead: true},
+		{name: "create existing forbidden", allowed: permissions{"update alertrules": true}, op: batchCreate("monitoring", "cpu-monitoring"), wantCode: http.StatusForbidden},
+		{name: "create existing", allowed: permissions{"create alertrules": true}, op: batchCreate("monitoring", "cpu-monitoring"), wantCode: http.StatusConflict, wantRead: true},
+		{name: "upsert existing forbidden", allowed: permissions{"create alertrules": true}, op: batchUpsert("monitoring", "cpu-monitoring", "cpu > 95"), wantCode: http.StatusForbidden},
+		{name: "upsert existing", allowed: permissions{"update alertrules": true}, op: batchUpsert("monitoring", "cpu-monitoring", "cpu > 95"), wantCode: http.StatusOK, wantRead: true},
+		{name: "upsert missing without create", allowed: permissions{"update alertrules": true}, op: batchUpsert("monitoring", "disk-alerts", "disk > 90"), wantCode: http.StatusForbidden, wantRead: true},
+		{name: "upsert missing", allowed: permissions{"update alertrules": true, "create alertrules": true}, op: batchUpsert("monitoring", "disk-alerts", "disk > 90"), wantCode: http.StatusCreated, wantRead: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newBatchTestServer(t, tt.allowed)
+
+			response := runBatchRequest(t, s, BatchRequest{Operations: []BatchOperation{tt.op}})
+			if code := response.Results[0].Code; code != tt.wantCode {
+				t.Errorf("code = %d, want %d", code, tt.wantCode)
+			}
+			// A forbidden operation is refused before the AlertRule is read, so its
+			// result can't tell whether the AlertRule exists
+			if read := c.gets.Load() > 0; read != tt.wantRead {
+				t.Errorf("AlertRule read = %v, want %v", read, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestBatchConcurrencyBounds(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		wantCode    int
+	}{
+		{concurrency: 0, wantCode: http.StatusOK},
+		{concurrency: 1, wantCode: http.StatusOK},
+		{concurrency: maxBatchConcurrency, wantCode: http.StatusOK},
+		{concurrency: -1, wantCode: http.StatusBadRequest},
+		{concurrency: maxBatchConcurrency + 1, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		s, _ := newBatchTestServer(t, nil)
+		body, err := json.Marshal(BatchRequest{
+			Concurrency: tt.concurrency,
+			Operations:  []BatchOperation{batchCreate("monitoring", "disk-alerts")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := serve(s, http.MethodPost, batchTestPath, string(body), nil)
+		if rec.Code != tt.wantCode {
+			t.Errorf("concurrency %d: code = %d, want %d: %s", tt.concurrency, rec.Code, tt.wantCode, rec.Body)
+			continue
+		}
+		if tt.wantCode == http.StatusBadRequest {
+			status := decodeStatus(t, rec)
+			if status.Details == nil || len(status.Details.Causes) != 1 || status.Details.Causes[0].Field != "concurrency" {
+				t.Errorf("concurrency %d: status = %+v, want a cause for concurrency", tt.concurrency, status)
+			}
+		}
+	}
+}
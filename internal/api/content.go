@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Media types of request and response bodies. JSON is the default, YAML is used when a
+// request asks for it.
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeYAML = "application/yaml"
+)
+
+// yamlMediaTypes are the names YAML goes by in Content-Type and Accept headers
+var yamlMediaTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// readBody reads a request body as JSON, converting it from YAML when the Content-Type
+// is YAML. Any other Content-Type, or none, is read as JSON.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !yamlMediaTypes[mediaType] || len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	converted, err := yaml.YAMLToJSON(body)
+	if err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("Invalid request body: %v", err))
+	}
+	return converted, nil
+}
+
+// decodeBody decodes a JSON or YAML request body into obj
+func decodeBody(r *http.Request, obj interface{}) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, obj); err != nil {
+		return errors.NewBadRequest(fmt.Sprintf("Invalid request body: %v", err))
+	}
+	return nil
+}
+
+// responseMediaType returns YAML if the Accept header prefers it to JSON, and JSON
+// otherwise. Of two types with the same quality, the one listed first wins.
+func responseMediaType(r *http.Request) string {
+	best, bestQuality := mediaTypeJSON, -1.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= bestQuality || quality == 0 {
+			continue
+		}
+		switch {
+		case yamlMediaTypes[mediaType]:
+			best, bestQuality = mediaTypeYAML, quality
+		case mediaType == mediaTypeJSON, mediaType == "application/*", mediaType == "*/*":
+			best, bestQuality = mediaTypeJSON, quality
+		}
+	}
+	return best
+}
+
+// encodeBody returns obj in the format the request accepts, and its media type
+func encodeBody(r *http.Request, obj interface{}) ([]byte, string, error) {
+	if responseMediaType(r) == mediaTypeYAML {
+		data, err := yaml.Marshal(obj)
+		return data, mediaTypeYAML, err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, mediaTypeJSON, err
+	}
+	return append(data, '\n'), mediaTypeJSON, nil
+}
+
+// writeObject writes obj with the given status code, as YAML if the request accepts it
+// and as JSON otherwise
+func (s *Server) writeObject(w http.ResponseWriter, r *http.Request, code int, obj interface{}) {
+	data, mediaType, err := encodeBody(r, obj)
+	if err != nil {
+		s.logFor(r).Error(err, "Failed to encode response")
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
+		s.logFor(r).Error(err, "Failed to write response")
+	}
+}
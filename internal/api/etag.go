@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// etag returns the entity tag of an object with the given resourceVersion. The
+// resourceVersion changes with every write, so it makes a strong validator.
+func etag(resourceVersion string) string {
+	return `"` + resourceVersion + `"`
+}
+
+// setETag sets the ETag header of a response to the object's resourceVersion
+func setETag(w http.ResponseWriter, resourceVersion string) {
+	if resourceVersion != "" {
+		w.Header().Set("ETag", etag(resourceVersion))
+	}
+}
+
+// ifMatch returns the resourceVersions listed in the If-Match header of r. present is
+// false without the header; wildcard is true for "If-Match: *".
+func ifMatch(r *http.Request) (resourceVersions []string, wildcard, present bool) {
+	header := r.Header.Values("If-Match")
+	if len(header) == 0 {
+		return nil, false, false
+	}
+	for _, value := range header {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				return nil, true, true
+			}
+			// Weak tags never match with If-Match, as required by RFC 9110
+			if strings.HasPrefix(tag, "W/") || len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+				continue
+			}
+			resourceVersions = append(resourceVersions, tag[1:len(tag)-1])
+		}
+	}
+	return resourceVersions, false, true
+}
+
+// checkIfMatch writes a 412 response and returns false when r has an If-Match header
+// that doesn't match the object's current resourceVersion
+func checkIfMatch(w http.ResponseWriter, r *http.Request, resourceVersion string) bool {
+	resourceVersions, wildcard, present := ifMatch(r)
+	if !present || wildcard {
+		return true
+	}
+	for _, rv := range resourceVersions {
+		if rv == resourceVersion {
+			return true
+		}
+	}
+	setETag(w, resourceVersion)
+	writeError(w, r, newStatusError(http.StatusPreconditionFailed, reasonPreconditionFailed,
+		"AlertRule has been modified since it was read, current ETag is "+etag(resourceVersion)))
+	return false
+}
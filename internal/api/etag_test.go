@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/mock"
+)
+
+const etagTestPath = "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring"
+
+// serve sends a request with the given headers through the server's handler chain
+func serve(s *Server, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// currentVersion returns the stored resourceVersion of the AlertRule at etagTestPath
+func currentVersion(t *testing.T, c client.Client) string {
+	t.Helper()
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "cpu-monitoring"}, alertRule); err != nil {
+		t.Fatal(err)
+	}
+	return alertRule.ResourceVersion
+}
+
+// updateBody returns a PUT body for the AlertRule at etagTestPath, with resourceVersion
+// in its metadata when set
+func updateBody(resourceVersion string) string {
+	return `{"metadata":{"name":"cpu-monitoring","resourceVersion":"` + resourceVersion + `"},` +
+		`"spec":{"groups":[{"name":"cpu.rules","rules":[{"alert":"HighCPU","expr":"cpu > 90"}]}]}}`
+}
+
+func TestGetETag(t *testing.T) {
+	s, c := newTestServer(t)
+
+	rec := serve(s, http.MethodGet, etagTestPath, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	if got, want := rec.Header().Get("ETag"), `"`+currentVersion(t, c)+`"`; got != want {
+		t.Errorf("ETag = %s, want %s", got, want)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	patch := map[string]string{"Content-Type": "application/merge-patch+json"}
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		headers  map[string]string
+		ifMatch  func(current string) string
+		wantCode int
+	}{
+		{name: "update current", method: http.MethodPut, path: etagTestPath, body: updateBody(""), ifMatch: quoted, wantCode: http.StatusOK},
+		{name: "update stale", method: http.MethodPut, path: etagTestPath, body: updateBody(""), ifMatch: stale, wantCode: http.StatusPreconditionFailed},
+		{name: "update any of several", method: http.MethodPut, path: etagTestPath, body: updateBody(""), ifMatch: func(rv string) string { return `"0", ` + quoted(rv) }, wantCode: http.StatusOK},
+		{name: "update wildcard", method: http.MethodPut, path: etagTestPath, body: updateBody(""), ifMatch: func(string) string { return "*" }, wantCode: http.StatusOK},
+		{name: "update weak tag", method: http.MethodPut, path: etagTestPath, body: updateBody(""), ifMatch: func(rv string) string { return "W/" + quoted(rv) }, wantCode: http.StatusPreconditionFailed},
+		{name: "patch current", method: http.MethodPatch, path: etagTestPath, body: `{"metadata":{"labels":{"team":"sre"}}}`, headers: patch, ifMatch: quoted, wantCode: http.StatusOK},
+		{name: "patch stale", method: http.MethodPatch, path: etagTestPath, body: `{"metadata":{"labels":{"team":"sre"}}}`, headers: patch, ifMatch: stale, wantCode: http.StatusPreconditionFailed},
+		{name: "delete stale", method: http.MethodDelete, path: etagTestPath, ifMatch: stale, wantCode: http.StatusPreconditionFailed},
+		{name: "delete current", method: http.MethodDelete, path: etagTestPath, ifMatch: quoted, wantCode: http.StatusNoContent},
+		{name: "rule update stale", method: http.MethodPut, path: etagTestPath + "/groups/cpu.rules/rules/HighCPUUsage", body: `{"alert":"HighCPUUsage","expr":"cpu > 90"}`, ifMatch: stale, wantCode: http.StatusPreconditionFailed},
+		{name: "rule update current", method: http.MethodPut, path: etagTestPath + "/groups/cpu.rules/rules/HighCPUUsage", body: `{"alert":"HighCPUUsage","expr":"cpu > 90"}`, ifMatch: quoted, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			before := currentVersion(t, c)
+
+			headers := map[string]string{"If-Match": tt.ifMatch(before)}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+			rec := serve(s, tt.method, tt.path, tt.body, headers)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			switch rec.Code {
+			case http.StatusPreconditionFailed:
+				status := decodeStatus(t, rec)
+				if status.Reason != reasonPreconditionFailed {
+					t.Errorf("reason = %q, want %q", status.Reason, reasonPreconditionFailed)
+				}
+				// The current ETag lets the client re-read or retry
+				if got := rec.Header().Get("ETag"); got != quoted(before) {
+					t.Errorf("ETag = %s, want %s", got, quoted(before))
+				}
+				if after := currentVersion(t, c); after != before {
+					t.Errorf("AlertRule changed from %s to %s despite the failed precondition", before, after)
+				}
+			case http.StatusOK:
+				after := currentVersion(t, c)
+				if after == before {
+					t.Fatal("AlertRule not updated")
+				}
+				if got := rec.Header().Get("ETag"); got != quoted(after) {
+					t.Errorf("ETag = %s, want the new version %s", got, quoted(after))
+				}
+			}
+		})
+	}
+}
+
+// quoted returns the ETag of resourceVersion
+func quoted(resourceVersion string) string {
+	return `"` + resourceVersion + `"`
+}
+
+// stale returns an ETag no AlertRule has, as resourceVersions start at 1
+func stale(string) string {
+	return `"0"`
+}
+
+func TestStaleResourceVersionConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		headers map[string]string
+	}{
+		{name: "update", method: http.MethodPut, body: updateBody("0")},
+		{name: "merge patch", method: http.MethodPatch, body: `{"metadata":{"resourceVersion":"0","labels":{"team":"sre"}}}`, headers: map[string]string{"Content-Type": "application/merge-patch+json"}},
+		{name: "JSON patch", method: http.MethodPatch, body: `[{"op":"replace","path":"/metadata/resourceVersion","value":"0"}]`, headers: map[string]string{"Content-Type": "application/json-patch+json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			before := currentVersion(t, c)
+
+			rec := serve(s, tt.method, etagTestPath, tt.body, tt.headers)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("code = %d, want 409: %s", rec.Code, rec.Body)
+			}
+			if status := decodeStatus(t, rec); status.Reason != metav1.StatusReasonConflict {
+				t.Errorf("reason = %q, want Conflict", status.Reason)
+			}
+			if after := currentVersion(t, c); after != before {
+				t.Errorf("AlertRule changed from %s to %s despite the conflict", before, after)
+			}
+		})
+	}
+}
+
+// racingClient changes the AlertRule right before each write, as another client
+// writing between the handler's read and its write would
+type racingClient struct {
+	*mock.MockClient
+}
+
+func (c racingClient) race(ctx context.Context, obj client.Object) error {
+	current := &monitoringv1alpha1.AlertRule{}
+	if err := c.MockClient.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+	current.Labels["raced"] = "true"
+	return c.MockClient.Update(ctx, current)
+}
+
+func (c racingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.race(ctx, obj); err != nil {
+		return err
+	}
+	return c.MockClient.Update(ctx, obj, opts...)
+}
+
+func (c racingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.race(ctx, obj); err != nil {
+		return err
+	}
+	return c.MockClient.Patch(ctx, obj, patch, opts...)
+}
+
+func TestConcurrentWriteConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		headers map[string]string
+	}{
+		{name: "update", method: http.MethodPut, body: updateBody("")},
+		{name: "patch", method: http.MethodPatch, body: `{"metadata":{"labels":{"team":"sre"}}}`, headers: map[string]string{"Content-Type": "application/merge-patch+json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mock.NewMockClient()
+			mock.PopulateExampleData(c)
+			s := NewServer(racingClient{c}, "")
+
+			rec := serve(s, tt.method, etagTestPath, tt.body, tt.headers)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("code = %d, want 409: %s", rec.Code, rec.Body)
+			}
+
+			if status := decodeStatus(t, rec); status.Reason != metav1.StatusReasonConflict {
+				t.Errorf("reason = %q, want Conflict", status.Reason)
+			}
+			got := &monitoringv1alpha1.AlertRule{}
+			if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "cpu-monitoring"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Labels["raced"] != "true" || got.Labels["team"] == "sre" {
+				t.Error("the write based on the outdated AlertRule was applied")
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+)
+
+// exportFormatPrometheus is the rule file format Prometheus loads with rule_files, and
+// the only export format
+const exportFormatPrometheus = "prometheus"
+
+// mediaTypeTar is the media type of an export with archive=tar
+const mediaTypeTar = "application/x-tar"
+
+// ruleFile is a Prometheus rule file
+type ruleFile struct {
+	Groups []monitoringv1.RuleGroup `json:"groups"`
+}
+
+// exportOptions are the query parameters of an export
+type exportOptions struct {
+	// tar exports one rule file per AlertRule in a tar archive
+	tar bool
+}
+
+// parseExportOptions reads the format and archive query parameters
+func parseExportOptions(r *http.Request) (exportOptions, error) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != exportFormatPrometheus {
+		return exportOptions{}, fmt.Errorf("invalid format %q: only %s is supported", format, exportFormatPrometheus)
+	}
+	switch archive := query.Get("archive"); archive {
+	case "":
+		return exportOptions{}, nil
+	case "tar":
+		return exportOptions{tar: true}, nil
+	default:
+		return exportOptions{}, fmt.Errorf("invalid archive %q: only tar is supported", archive)
+	}
+}
+
+// exportAlertRule writes the Prometheus rule file for one AlertRule
+func (s *Server) exportAlertRule(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if !s.authorize(w, r, "get", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
+
+	opts, err := parseExportOptions(r)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
+	}
+
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, alertRule); err != nil {
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	s.writeExport(w, r, []*monitoringv1alpha1.AlertRule{alertRule}, opts, name)
+}
+
+// exportAlertRules writes the Prometheus rules of every AlertRule that matches the
+// labelSelector and fieldSelector, as one rule file or as a tar of one file per
+// AlertRule. Exports aren't paginated, so limit and continue are ignored.
+func (s *Server) exportAlertRules(w http.ResponseWriter, r *http.Request, namespace string) {
+	if !s.authorize(w, r, "list", alertRulesResource, namespace, "") {
+		return
+	}
+
+	ctx := r.Context()
+
+	opts, err := parseExportOptions(r)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
+	}
+	query, err := parseListQuery(r, namespace)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
+	}
+
+	alertRuleList := &monitoringv1alpha1.AlertRuleList{}
+	if err := s.client.List(ctx, alertRuleList, listOptsWithoutPaging(query.opts)...); err != nil {
+		s.logFor(r).Error(err, "Failed to list AlertRules for export")
+		writeError(w, r, err)
+		return
+	}
+	query.filter(alertRuleList)
+
+	alertRules := make([]*monitoringv1alpha1.AlertRule, 0, len(alertRuleList.Items))
+	for i := range alertRuleList.Items {
+		alertRules = append(alertRules, &alertRuleList.Items[i])
+	}
+
+	filename := "alertrules"
+	if namespace != "" {
+		filename = namespace
+	}
+	s.writeExport(w, r, alertRules, opts, filename)
+}
+
+// writeExport writes the rule file or tar archive for alertRules. filename names the
+// download, without its extension.
+func (s *Server) writeExport(w http.ResponseWriter, r *http.Request, alertRules []*monitoringv1alpha1.AlertRule, opts exportOptions, filename string) {
+	var (
+		data      []byte
+		mediaType string
+		err       error
+	)
+	if opts.tar {
+		data, err = ruleFileArchive(alertRules, time.Now())
+		mediaType, filename = mediaTypeTar, filename+".tar"
+	} else {
+		data, err = renderRuleFile(alertRules)
+		mediaType, filename = mediaTypeYAML, filename+".rules.yaml"
+	}
+	if err != nil {
+		if !errors.IsBadRequest(err) {
+			s.logFor(r).Error(err, "Failed to render export")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := w.Write(data); err != nil {
+		s.logFor(r).Error(err, "Failed to write export")
+	}
+}
+
+// renderRuleFile renders the rules of alertRules as one Prometheus rule file, converted
+// as for the PrometheusRules the operator generates. Prometheus rejects a file that
+// repeats a group name, so groups with the same name in different AlertRules are an
+// error.
+func renderRuleFile(alertRules []*monitoringv1alpha1.AlertRule) ([]byte, error) {
+	file := ruleFile{Groups: []monitoringv1.RuleGroup{}}
+	groupOwners := map[string]string{}
+	sources := make([]string, 0, len(alertRules))
+	for _, alertRule := range alertRules {
+		source := alertRule.Namespace + "/" + alertRule.Name
+		for _, group := range render.GeneratePrometheusRule(alertRule).Spec.Groups {
+			if owner, ok := groupOwners[group.Name]; ok {
+				return nil, errors.NewBadRequest(fmt.Sprintf(
+					"Rule group %q is in both AlertRule %s and %s, which one rule file can't hold; export with archive=tar for a file per AlertRule",
+					group.Name, owner, source))
+			}
+			groupOwners[group.Name] = source
+			file.Groups = append(file.Groups, group)
+		}
+		sources = append(sources, source)
+	}
+
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if len(sources) == 1 {
+		fmt.Fprintf(&buf, "# Generated by kneutral-operator from AlertRule %s\n", sources[0])
+	} else {
+		fmt.Fprintf(&buf, "# Generated by kneutral-operator from %d AlertRules\n", len(sources))
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// ruleFileArchive returns a tar archive with a rule file per AlertRule, named
+// {namespace}/{name}.rules.yaml
+func ruleFileArchive(alertRules []*monitoringv1alpha1.AlertRule, modTime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	for _, alertRule := range alertRules {
+		data, err := renderRuleFile([]*monitoringv1alpha1.AlertRule{alertRule})
+		if err != nil {
+			return nil, err
+		}
+		header := &tar.Header{
+			Name:    path.Join(alertRule.Namespace, alertRule.Name+".rules.yaml"),
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: modTime,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := archive.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
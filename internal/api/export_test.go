@@ -0,0 +1,213 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// decodeRuleFile parses an exported rule file
+func decodeRuleFile(t *testing.T, data []byte) ruleFile {
+	t.Helper()
+	file := ruleFile{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		t.Fatalf("export is not a rule file: %v: %s", err, data)
+	}
+	return file
+}
+
+// exportedGroups returns the names of the groups of a rule file, sorted
+func exportedGroups(file ruleFile) []string {
+	names := []string{}
+	for _, group := range file.Groups {
+		names = append(names, group.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestExportAlertRule(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec := serve(s, http.MethodGet, "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/export", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != mediaTypeYAML {
+		t.Errorf("Content-Type = %q, want %q", contentType, mediaTypeYAML)
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); disposition != `attachment; filename="cpu-monitoring.rules.yaml"` {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "# Generated by kneutral-operator from AlertRule monitoring/cpu-monitoring\n") {
+		t.Errorf("export doesn't name its AlertRule: %s", rec.Body)
+	}
+
+	file := decodeRuleFile(t, rec.Body.Bytes())
+	if len(file.Groups) != 1 {
+		t.Fatalf("groups = %+v, want cpu.rules", file.Groups)
+	}
+	group := file.Groups[0]
+	if group.Name != "cpu.rules" || group.Interval == nil || *group.Interval != "30s" || len(group.Rules) != 2 {
+		t.Fatalf("group = %+v, want cpu.rules every 30s with 2 rules", group)
+	}
+	rule := group.Rules[0]
+	if rule.Alert != "HighCPUUsage" || rule.For == nil || *rule.For != "5m" || rule.Labels["severity"] != "warning" ||
+		rule.Annotations["summary"] != "High CPU usage on {{ $labels.instance }}" {
+		t.Errorf("rule = %+v, want HighCPUUsage as stored", rule)
+	}
+}
+
+func TestExportAlertRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantFilename string
+		wantHeader   string
+		wantGroups   []string
+	}{
+		{
+			name:         "all namespaces",
+			path:         "/api/v1/alertrules:export",
+			wantFilename: "alertrules.rules.yaml",
+			wantHeader:   "# Generated by kneutral-operator from 3 AlertRules\n",
+			wantGroups:   []string{"app.error_rate", "app.response_time", "cpu.rules", "kneutral.arista.dom"},
+		},
+		{
+			name:         "one namespace",
+			path:         "/api/v1/namespaces/production/alertrules:export",
+			wantFilename: "production.rules.yaml",
+			wantHeader:   "# Generated by kneutral-operator from AlertRule production/app-performance\n",
+			wantGroups:   []string{"app.error_rate", "app.response_time"},
+		},
+		{
+			name:         "label selector",
+			path:         "/api/v1/alertrules:export?labelSelector=team%3Dplatform",
+			wantFilename: "alertrules.rules.yaml",
+			wantHeader:   "# Generated by kneutral-operator from AlertRule monitoring/cpu-monitoring\n",
+			wantGroups:   []string{"cpu.rules"},
+		},
+		{
+			name:         "nothing selected",
+			path:         "/api/v1/alertrules:export?labelSelector=team%3Dnobody",
+			wantFilename: "alertrules.rules.yaml",
+			wantHeader:   "# Generated by kneutral-operator from 0 AlertRules\n",
+			wantGroups:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+
+			rec := serve(s, http.MethodGet, tt.path, "", nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+			}
+			if disposition := rec.Header().Get("Content-Disposition"); disposition != `attachment; filename="`+tt.wantFilename+`"` {
+				t.Errorf("Content-Disposition = %q, want filename %s", disposition, tt.wantFilename)
+			}
+			if !strings.HasPrefix(rec.Body.String(), tt.wantHeader) {
+				t.Errorf("export starts %q, want %q", strings.SplitN(rec.Body.String(), "\n", 2)[0], tt.wantHeader)
+			}
+			if got := exportedGroups(decodeRuleFile(t, rec.Body.Bytes())); !reflect.DeepEqual(got, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", got, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestExportArchive(t *testing.T) {
+	s, c := newTestServer(t)
+
+	// A group name another AlertRule uses too, which one rule file can't hold
+	duplicate := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu-monitoring", Namespace: "staging"},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Groups: []monitoringv1alpha1.AlertGroup{{Name: "cpu.rules", Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPUUsage", Expr: "cpu > 80"}}}},
+		},
+	}
+	if err := c.Create(context.Background(), duplicate); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(s, http.MethodGet, "/api/v1/alertrules:export", "", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("code of a single file = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	if status := decodeStatus(t, rec); !strings.Contains(status.Message, "archive=tar") {
+		t.Errorf("message = %q, want it to suggest archive=tar", status.Message)
+	}
+
+	rec = serve(s, http.MethodGet, "/api/v1/alertrules:export?archive=tar", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != mediaTypeTar {
+		t.Errorf("Content-Type = %q, want %q", contentType, mediaTypeTar)
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); disposition != `attachment; filename="alertrules.tar"` {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+
+	files := map[string][]string{}
+	archive := tar.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Mode != 0o644 || header.Typeflag != tar.TypeReg {
+			t.Errorf("%s: mode %o, type %c, want a regular file with mode 644", header.Name, header.Mode, header.Typeflag)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = exportedGroups(decodeRuleFile(t, data))
+	}
+
+	want := map[string][]string{
+		"monitoring/cpu-monitoring.rules.yaml":     {"cpu.rules"},
+		"network/arista-dom-monitoring.rules.yaml": {"kneutral.arista.dom"},
+		"production/app-performance.rules.yaml":    {"app.error_rate", "app.response_time"},
+		"staging/cpu-monitoring.rules.yaml":        {"cpu.rules"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("archive = %v, want %v", files, want)
+	}
+}
+
+func TestExportOptions(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, path := range []string{
+		"/api/v1/alertrules:export?format=json",
+		"/api/v1/alertrules:export?archive=zip",
+		"/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/export?format=json",
+	} {
+		rec := serve(s, http.MethodGet, path, "", nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400: %s", path, rec.Code, rec.Body)
+		}
+	}
+
+	rec := serve(s, http.MethodGet, "/api/v1/namespaces/monitoring/alertrules/missing/export", "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("export of a missing AlertRule: code = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
+)
+
+// importDocument is the body of an import: a Prometheus rules file, which only has
+// groups, or a PrometheusRule manifest
+type importDocument struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        metav1.ObjectMeta `json:"metadata"`
+	Spec            json.RawMessage   `json:"spec"`
+	Groups          json.RawMessage   `json:"groups"`
+}
+
+// generatedLabels are set by the operator on every PrometheusRule it generates. They
+// aren't carried over from an imported PrometheusRule, where they would name the
+// AlertRule it was generated from.
+var generatedLabels = []string{render.ManagedByLabel, render.InstanceLabel, render.NameLabel}
+
+// importAlertRule creates an AlertRule from a Prometheus rules file or a PrometheusRule
+// manifest, in JSON or YAML. The name query parameter names the AlertRule, and is
+// required for a rules file; a PrometheusRule's own name is used otherwise.
+func (s *Server) importAlertRule(w http.ResponseWriter, r *http.Request, namespace string) {
+	if !s.authorize(w, r, "create", alertRulesResource, namespace, "") {
+		return
+	}
+
+	ctx := r.Context()
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var opts []client.CreateOption
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	alertRule, err := convertImport(body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		alertRule.Name = name
+	}
+	alertRule.Namespace = namespace
+
+	if alertRule.Name == "" {
+		writeError(w, r, newInvalid("", field.ErrorList{field.Required(field.NewPath("metadata", "name"),
+			"a rules file has no name, set one with the name query parameter")}))
+		return
+	}
+
+	validation.SetDefaults(&alertRule.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&alertRule.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&alertRule.Spec), metrics.SourceAPI).Inc()
+		writeError(w, r, newInvalid(alertRule.Name, errs))
+		return
+	}
+
+	if err := s.client.Create(ctx, alertRule, opts...); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			s.logFor(r).Error(err, "Failed to create AlertRule")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, alertRule.ResourceVersion)
+	s.writeObject(w, r, http.StatusCreated, alertRule)
+}
+
+// convertImport converts a rules file or PrometheusRule manifest into an AlertRule.
+// Rule group and rule fields an AlertRule can't hold, such as limit or keep_firing_for,
+// are rejected rather than dropped.
+func convertImport(body []byte) (*monitoringv1alpha1.AlertRule, error) {
+	var doc importDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("Invalid request body: %v", err))
+	}
+
+	alertRule := &monitoringv1alpha1.AlertRule{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: monitoringv1alpha1.GroupVersion.String(),
+			Kind:       "AlertRule",
+		},
+	}
+
+	groups := doc.Groups
+	switch {
+	case doc.Kind == monitoringv1.PrometheusRuleKind:
+		var spec struct {
+			Groups json.RawMessage `json:"groups"`
+		}
+		if len(doc.Spec) > 0 {
+			if err := json.Unmarshal(doc.Spec, &spec); err != nil {
+				return nil, errors.NewBadRequest(fmt.Sprintf("Invalid PrometheusRule spec: %v", err))
+			}
+		}
+		groups = spec.Groups
+		alertRule.Name = doc.Metadata.Name
+		// The labels of a PrometheusRule select it for a Prometheus, so the generated one
+		// keeps them
+		alertRule.Spec.Labels = doc.Metadata.Labels
+		for _, k := range generatedLabels {
+			delete(alertRule.Spec.Labels, k)
+		}
+	case doc.Kind != "":
+		return nil, errors.NewBadRequest(fmt.Sprintf("Can't import kind %s, expected a Prometheus rules file or a PrometheusRule", doc.Kind))
+	case len(groups) == 0:
+		return nil, errors.NewBadRequest("Expected a Prometheus rules file with groups, or a PrometheusRule")
+	}
+
+	if len(groups) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(groups))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&alertRule.Spec.Groups); err != nil {
+			return nil, errors.NewBadRequest(fmt.Sprintf("Can't import rule groups: %v. AlertRule groups have a name, interval and rules, "+
+				"and rules an alert or record, expr, for, labels and annotations", err))
+		}
+	}
+	return alertRule, nil
+}
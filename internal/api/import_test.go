@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+)
+
+func TestImportGeneratedPrometheusRule(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// A PrometheusRule the operator generated, as exported from another cluster
+	exported := render.GeneratePrometheusRule(&monitoringv1alpha1.AlertRule{
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Labels: map[string]string{"prometheus": "main"},
+			Groups: []monitoringv1alpha1.AlertGroup{{Name: "cpu.rules", Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 80"}}}},
+		},
+	})
+	exported.Name = "kneutral-cpu"
+	body, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(s, http.MethodPost, "/api/v1/namespaces/monitoring/alertrules:import?name=cpu", string(body), nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := json.Unmarshal(rec.Body.Bytes(), alertRule); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"prometheus": "main"}
+	if len(alertRule.Spec.Labels) != len(want) || alertRule.Spec.Labels["prometheus"] != "main" {
+		t.Errorf("labels = %v, want %v without the labels the operator generates", alertRule.Spec.Labels, want)
+	}
+}
+
+func TestImportRulesFile(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// Prometheus durations such as 1d are valid in rule files
+	rulesFile := `groups:
+- name: disk.rules
+  interval: 1h
+  rules:
+  - alert: DiskFillingUp
+    expr: predict_linear(node_filesystem_avail_bytes[6h], 4 * 3600) < 0
+    for: 1d
+    labels:
+      severity: critical
+`
+	rec := serve(s, http.MethodPost, "/api/v1/namespaces/monitoring/alertrules:import?name=disk", rulesFile,
+		map[string]string{"Content-Type": "application/yaml", "Accept": "application/json"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := json.Unmarshal(rec.Body.Bytes(), alertRule); err != nil {
+		t.Fatal(err)
+	}
+	if len(alertRule.Spec.Groups) != 1 || len(alertRule.Spec.Groups[0].Rules) != 1 || alertRule.Spec.Groups[0].Rules[0].For != "1d" {
+		t.Errorf("groups = %+v, want disk.rules with DiskFillingUp for 1d", alertRule.Spec.Groups)
+	}
+
+	// Without a name the rules file can't be imported
+	rec = serve(s, http.MethodPost, "/api/v1/namespaces/monitoring/alertrules:import", rulesFile,
+		map[string]string{"Content-Type": "application/yaml"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("code without a name = %d, want 400: %s", rec.Code, rec.Body)
+	}
+}
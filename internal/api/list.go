@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// serverSideFields are the field selector fields the Kubernetes API server supports for
+// custom resources. Without selectableFields, which this Kubernetes version doesn't
+// have, those are only metadata.name and metadata.namespace. Other fields are matched
+// here after listing.
+var serverSideFields = map[string]bool{
+	"metadata.name":      true,
+	"metadata.namespace": true,
+}
+
+// listQuery holds the list options parsed from a request's query parameters
+type listQuery struct {
+	opts []client.ListOption
+
+	namespace     string
+	labelSelector labels.Selector
+
+	// fieldSelector is matched against the listed items. It is nil without a
+	// fieldSelector parameter.
+	fieldSelector fields.Selector
+}
+
+// parseListQuery reads the labelSelector, fieldSelector, limit and continue query parameters
+func parseListQuery(r *http.Request, namespace string) (*listQuery, error) {
+	query := r.URL.Query()
+	q := &listQuery{namespace: namespace, labelSelector: labels.Everything()}
+	if namespace != "" {
+		q.opts = append(q.opts, client.InNamespace(namespace))
+	}
+
+	if value := query.Get("labelSelector"); value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labelSelector: %w", err)
+		}
+		q.opts = append(q.opts, client.MatchingLabelsSelector{Selector: selector})
+		q.labelSelector = selector
+	}
+
+	if value := query.Get("fieldSelector"); value != "" {
+		selector, err := fields.ParseSelector(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fieldSelector: %w", err)
+		}
+
+		// Terms on fields the API server supports are passed on, the rest are only
+		// matched here
+		var serverSide []fields.Selector
+		for _, requirement := range selector.Requirements() {
+			if _, ok := monitoringv1alpha1.AlertRuleFields(&monitoringv1alpha1.AlertRule{})[requirement.Field]; !ok {
+				return nil, fmt.Errorf("invalid fieldSelector: field %q is not supported, use metadata.name, metadata.namespace or status.state", requirement.Field)
+			}
+			if !serverSideFields[requirement.Field] {
+				continue
+			}
+			if requirement.Operator == selection.NotEquals {
+				serverSide = append(serverSide, fields.OneTermNotEqualSelector(requirement.Field, requirement.Value))
+			} else {
+				serverSide = append(serverSide, fields.OneTermEqualSelector(requirement.Field, requirement.Value))
+			}
+		}
+		if len(serverSide) > 0 {
+			q.opts = append(q.opts, client.MatchingFieldsSelector{Selector: fields.AndSelectors(serverSide...)})
+		}
+		q.fieldSelector = selector
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit %q: must be a positive integer", value)
+		}
+		q.opts = append(q.opts, client.Limit(limit))
+	}
+
+	if value := query.Get("continue"); value != "" {
+		q.opts = append(q.opts, client.Continue(value))
+	}
+
+	return q, nil
+}
+
+// filter removes the items that don't match the field selector. As with the API
+// server's own filtering, a page can end up shorter than the limit while more pages
+// remain.
+func (q *listQuery) filter(alertRuleList *monitoringv1alpha1.AlertRuleList) {
+	if q.fieldSelector == nil {
+		return
+	}
+	items := alertRuleList.Items[:0]
+	for i := range alertRuleList.Items {
+		if q.fieldSelector.Matches(monitoringv1alpha1.AlertRuleFields(&alertRuleList.Items[i])) {
+			items = append(items, alertRuleList.Items[i])
+		}
+	}
+	alertRuleList.Items = items
+	// The count the API server gave no longer applies after filtering
+	alertRuleList.RemainingItemCount = nil
+}
+
+// matches reports whether an AlertRule matches the namespace and selectors of the query
+func (q *listQuery) matches(alertRule *monitoringv1alpha1.AlertRule) bool {
+	if q.namespace != "" && alertRule.Namespace != q.namespace {
+		return false
+	}
+	if !q.labelSelector.Matches(labels.Set(alertRule.Labels)) {
+		return false
+	}
+	return q.fieldSelector == nil || q.fieldSelector.Matches(monitoringv1alpha1.AlertRuleFields(alertRule))
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// recordingReader remembers the options of the last list and answers lists with a
+// continue token of "expired" the way the API server answers one that is too old
+type recordingReader struct {
+	client.Reader
+	opts *client.ListOptions
+}
+
+func (r *recordingReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	r.opts = &client.ListOptions{}
+	r.opts.ApplyOptions(opts)
+	if r.opts.Continue == "expired" {
+		return errors.NewResourceExpired("The provided continue parameter is too old to display a consistent list result. You can start a new list without the continue parameter.")
+	}
+	return r.Reader.List(ctx, list, opts...)
+}
+
+// listNames lists AlertRules with the given query and returns the names listed and the
+// continue token
+func listNames(t *testing.T, s *Server, path string, query url.Values) ([]string, string) {
+	t.Helper()
+	rec := serve(s, http.MethodGet, path+"?"+query.Encode(), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	list := &monitoringv1alpha1.AlertRuleList{}
+	if err := json.Unmarshal(rec.Body.Bytes(), list); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+	return names, list.Continue
+}
+
+func TestListSelectors(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		query      url.Values
+		wantNames  []string
+		wantServer string
+	}{
+		{name: "everything", path: "/api/v1/alertrules", wantNames: []string{"cpu-monitoring", "arista-dom-monitoring", "app-performance"}},
+		{name: "in a namespace", path: "/api/v1/namespaces/production/alertrules", wantNames: []string{"app-performance"}},
+		{name: "label equality", path: "/api/v1/alertrules", query: url.Values{"labelSelector": {"team=platform"}}, wantNames: []string{"cpu-monitoring"}},
+		{name: "label set", path: "/api/v1/alertrules", query: url.Values{"labelSelector": {"category in (network,application)"}}, wantNames: []string{"arista-dom-monitoring", "app-performance"}},
+		{name: "label exists", path: "/api/v1/alertrules", query: url.Values{"labelSelector": {"!team"}}, wantNames: []string{"arista-dom-monitoring"}},
+		{
+			name:       "field name",
+			path:       "/api/v1/alertrules",
+			query:      url.Values{"fieldSelector": {"metadata.name=app-performance"}},
+			wantNames:  []string{"app-performance"},
+			wantServer: "metadata.name=app-performance",
+		},
+		{
+			name:       "field namespace excluded",
+			path:       "/api/v1/alertrules",
+			query:      url.Values{"fieldSelector": {"metadata.namespace!=monitoring"}},
+			wantNames:  []string{"arista-dom-monitoring", "app-performance"},
+			wantServer: "metadata.namespace!=monitoring",
+		},
+		{
+			name:      "state matched after listing",
+			path:      "/api/v1/alertrules",
+			query:     url.Values{"fieldSelector": {"status.state=Active"}},
+			wantNames: []string{"cpu-monitoring", "arista-dom-monitoring", "app-performance"},
+		},
+		{
+			name:       "state and namespace",
+			path:       "/api/v1/alertrules",
+			query:      url.Values{"fieldSelector": {"metadata.namespace=network,status.state!=Active"}},
+			wantNames:  []string{},
+			wantServer: "metadata.namespace=network",
+		},
+		{
+			name:       "labels and fields",
+			path:       "/api/v1/alertrules",
+			query:      url.Values{"labelSelector": {"category"}, "fieldSelector": {"metadata.namespace=network"}},
+			wantNames:  []string{"arista-dom-monitoring"},
+			wantServer: "metadata.namespace=network",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			reader := &recordingReader{Reader: c}
+			s.SetListReader(reader)
+
+			names, _ := listNames(t, s, tt.path, tt.query)
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("listed %v, want %v", names, tt.wantNames)
+			}
+
+			// Only the fields the API server supports for custom resources are sent to it
+			var server string
+			if reader.opts.FieldSelector != nil {
+				server = reader.opts.FieldSelector.String()
+			}
+			if server != tt.wantServer {
+				t.Errorf("field selector sent to the API server = %q, want %q", server, tt.wantServer)
+			}
+		})
+	}
+}
+
+func TestListPages(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	var pages [][]string
+	query := url.Values{"limit": {"2"}}
+	for {
+		names, next := listNames(t, s, "/api/v1/alertrules", query)
+		pages = append(pages, names)
+		if next == "" {
+			break
+		}
+		if len(pages) > 3 {
+			t.Fatalf("pages don't end: %v", pages)
+		}
+		query.Set("continue", next)
+	}
+
+	want := [][]string{{"cpu-monitoring", "arista-dom-monitoring"}, {"app-performance"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+}
+
+func TestListPageFiltered(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// Terms matched after listing can leave a page short while more pages remain
+	names, next := listNames(t, s, "/api/v1/alertrules", url.Values{"limit": {"1"}, "fieldSelector": {"status.state!=Active"}})
+	if len(names) != 0 || next == "" {
+		t.Errorf("listed %v with continue %q, want an empty page and a continue token", names, next)
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantCode   int32
+		wantReason metav1.StatusReason
+	}{
+		{name: "bad label selector", query: url.Values{"labelSelector": {"team in (platform"}}, wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest},
+		{name: "bad field selector", query: url.Values{"fieldSelector": {"metadata.name"}}, wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest},
+		{name: "unsupported field", query: url.Values{"fieldSelector": {"spec.groups=cpu"}}, wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest},
+		{name: "zero limit", query: url.Values{"limit": {"0"}}, wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest},
+		{name: "limit not a number", query: url.Values{"limit": {"ten"}}, wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest},
+		{name: "malformed continue token", query: url.Values{"continue": {"!!"}}, wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest},
+		{name: "stale continue token", query: url.Values{"continue": {"expired"}}, wantCode: http.StatusGone, wantReason: metav1.StatusReasonExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			s.SetListReader(&recordingReader{Reader: c})
+
+			rec := serve(s, http.MethodGet, "/api/v1/alertrules?"+tt.query.Encode(), "", nil)
+			if rec.Code != int(tt.wantCode) {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			status := decodeStatus(t, rec)
+			if status.Code != tt.wantCode || status.Reason != tt.wantReason {
+				t.Errorf("status = %d %s, want %d %s", status.Code, status.Reason, tt.wantCode, tt.wantReason)
+			}
+		})
+	}
+}
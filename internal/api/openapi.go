@@ -11,35 +11,677 @@ func getOpenAPISpec() map[string]interface{} {
 		},
 		"basePath": "/api/v1",
 		"schemes":  []string{"http", "https"},
-		"consumes": []string{"application/json"},
-		"produces": []string{"application/json"},
+		"consumes": []string{"application/json", "application/yaml"},
+		"produces": []string{"application/json", "application/yaml"},
+		"securityDefinitions": map[string]interface{}{
+			"bearerToken": map[string]interface{}{
+				"type":        "apiKey",
+				"in":          "header",
+				"name":        "Authorization",
+				"description": "Kubernetes bearer token as \"Bearer <token>\", validated with a TokenReview",
+			},
+			"apiKey": map[string]interface{}{
+				"type":        "apiKey",
+				"in":          "header",
+				"name":        "X-API-Key",
+				"description": "Static API key from the Secret named by --api-keys-secret",
+			},
+		},
+		"security": []map[string]interface{}{
+			{"bearerToken": []string{}},
+			{"apiKey": []string{}},
+		},
+		"parameters": map[string]interface{}{
+			"labelSelector": map[string]interface{}{
+				"name":        "labelSelector",
+				"in":          "query",
+				"type":        "string",
+				"description": "Only return AlertRules whose labels match this label selector",
+			},
+			"fieldSelector": map[string]interface{}{
+				"name":        "fieldSelector",
+				"in":          "query",
+				"type":        "string",
+				"description": "Only return AlertRules matching this selector on metadata.name, metadata.namespace or status.state",
+			},
+			"limit": map[string]interface{}{
+				"name":        "limit",
+				"in":          "query",
+				"type":        "integer",
+				"minimum":     1,
+				"description": "Maximum number of AlertRules to return",
+			},
+			"continue": map[string]interface{}{
+				"name":        "continue",
+				"in":          "query",
+				"type":        "string",
+				"description": "metadata.continue token of the previous page",
+			},
+			"exportFormat": map[string]interface{}{
+				"name":        "format",
+				"in":          "query",
+				"type":        "string",
+				"enum":        []string{"prometheus"},
+				"default":     "prometheus",
+				"description": "Format of the export, Prometheus rule files are the only one",
+			},
+			"exportArchive": map[string]interface{}{
+				"name":        "archive",
+				"in":          "query",
+				"type":        "string",
+				"enum":        []string{"tar"},
+				"description": "Return a tar with a rule file per AlertRule instead of one rule file",
+			},
+			"dryRun": map[string]interface{}{
+				"name":        "dryRun",
+				"in":          "query",
+				"type":        "string",
+				"enum":        []string{"All"},
+				"description": "Validate and admit the request without storing anything",
+			},
+			"watch": map[string]interface{}{
+				"name":        "watch",
+				"in":          "query",
+				"type":        "boolean",
+				"description": "Stream changes as newline-delimited watch events, or as Server-Sent Events with Accept: text/event-stream",
+			},
+			"resourceVersion": map[string]interface{}{
+				"name":        "resourceVersion",
+				"in":          "query",
+				"type":        "string",
+				"description": "With watch, only send changes after this resourceVersion",
+			},
+			"timeoutSeconds": map[string]interface{}{
+				"name":        "timeoutSeconds",
+				"in":          "query",
+				"type":        "integer",
+				"minimum":     1,
+				"description": "With watch, end the stream after this many seconds",
+			},
+		},
 		"paths": map[string]interface{}{
 			"/health": map[string]interface{}{
 				"get": map[string]interface{}{
-					"summary":     "Health check",
-					"description": "Check if the API server is healthy",
+					"summary":     "Health check",
+					"description": "Check if the API server is healthy",
+					"security":    []map[string]interface{}{},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "API server is healthy",
+						},
+					},
+				},
+			},
+			"/alertrules": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "List all AlertRules",
+					"description": "List all AlertRules across all namespaces",
+					"produces":    []string{"application/json", "application/x-ndjson", "text/event-stream"},
+					"parameters": []map[string]interface{}{
+						{"$ref": "#/parameters/labelSelector"},
+						{"$ref": "#/parameters/fieldSelector"},
+						{"$ref": "#/parameters/limit"},
+						{"$ref": "#/parameters/continue"},
+						{"$ref": "#/parameters/watch"},
+						{"$ref": "#/parameters/resourceVersion"},
+						{"$ref": "#/parameters/timeoutSeconds"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "List of AlertRules",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid selector, limit, continue token, resourceVersion or timeoutSeconds",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"410": map[string]interface{}{
+							"description": "Continue token or watch resourceVersion expired",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/alertrules:batch": map[string]interface{}{
+				"post": map[string]interface{}{
+					"summary":     "Batch AlertRule operations",
+					"description": "Create, upsert and delete AlertRules across namespaces with bounded concurrency, optionally all-or-nothing, and report the outcome of each",
+					"parameters": []map[string]interface{}{
+						{
+							"name":     "body",
+							"in":       "body",
+							"required": true,
+							"schema": map[string]interface{}{
+								"$ref": "#/definitions/BatchRequest",
+							},
+						},
+						{"$ref": "#/parameters/dryRun"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Outcome of every operation, whether or not they succeeded",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/BatchResponse"},
+						},
+						"400": map[string]interface{}{
+							"description": "Malformed batch, such as an atomic one with deletes, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/alertrules:export": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "Export AlertRules",
+					"description": "Render the matching AlertRules in all namespaces as one Prometheus rule file, or a file each with archive=tar",
+					"produces":    []string{"application/yaml", "application/x-tar"},
+					"parameters": []map[string]interface{}{
+						{"$ref": "#/parameters/labelSelector"},
+						{"$ref": "#/parameters/fieldSelector"},
+						{"$ref": "#/parameters/exportFormat"},
+						{"$ref": "#/parameters/exportArchive"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Prometheus rule file, or a tar of rule files with archive=tar",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid parameters, or a group name repeats without archive=tar",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/search": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "Search rules",
+					"description": "Find the rules of every AlertRule that match all the given parameters, with the namespace, AlertRule and group of each",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "alert",
+							"in":          "query",
+							"type":        "string",
+							"description": "Glob on the alert name, recording rules never match it",
+						},
+						{
+							"name":        "metric",
+							"in":          "query",
+							"type":        "string",
+							"description": "Glob on the metric names the expr selects, found by parsing it as PromQL",
+						},
+						{
+							"name":             "label",
+							"in":               "query",
+							"type":             "array",
+							"items":            map[string]interface{}{"type": "string"},
+							"collectionFormat": "multi",
+							"description":      "Matcher on the rule's labels: name=value, name!=value, name=~regex or name!~regex",
+						},
+						{
+							"name":        "annotation",
+							"in":          "query",
+							"type":        "string",
+							"description": "Text an annotation value contains, ignoring case",
+						},
+						{
+							"name":        "severity",
+							"in":          "query",
+							"type":        "string",
+							"description": "Value of the severity label, or several separated by commas",
+						},
+						{
+							"name":        "namespace",
+							"in":          "query",
+							"type":        "string",
+							"description": "Only search AlertRules in this namespace",
+						},
+						{"$ref": "#/parameters/labelSelector"},
+						{"$ref": "#/parameters/fieldSelector"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Matching rules",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/SearchResponse"},
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid glob, label matcher or selector",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/namespaces/{namespace}/alertrules": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "List AlertRules in namespace",
+					"description": "List all AlertRules in a specific namespace",
+					"produces":    []string{"application/json", "application/x-ndjson", "text/event-stream"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{"$ref": "#/parameters/labelSelector"},
+						{"$ref": "#/parameters/fieldSelector"},
+						{"$ref": "#/parameters/limit"},
+						{"$ref": "#/parameters/continue"},
+						{"$ref": "#/parameters/watch"},
+						{"$ref": "#/parameters/resourceVersion"},
+						{"$ref": "#/parameters/timeoutSeconds"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "List of AlertRules",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid selector, limit, continue token, resourceVersion or timeoutSeconds",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"410": map[string]interface{}{
+							"description": "Continue token or watch resourceVersion expired",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+				"post": map[string]interface{}{
+					"summary":     "Create AlertRule",
+					"description": "Create a new AlertRule in the namespace",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "body",
+							"in":          "body",
+							"required":    true,
+							"description": "AlertRule object",
+							"schema": map[string]interface{}{
+								"$ref": "#/definitions/AlertRule",
+							},
+						},
+						{"$ref": "#/parameters/dryRun"},
+					},
+					"responses": map[string]interface{}{
+						"201": map[string]interface{}{
+							"description": "AlertRule created",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid request, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"409": map[string]interface{}{
+							"description": "AlertRule already exists",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/namespaces/{namespace}/alertrules:import": map[string]interface{}{
+				"post": map[string]interface{}{
+					"summary":     "Import AlertRule",
+					"description": "Create an AlertRule from a Prometheus rules file or a PrometheusRule manifest",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "query",
+							"type":        "string",
+							"description": "AlertRule name, required for a rules file and defaulting to the PrometheusRule's name otherwise",
+						},
+						{
+							"name":        "body",
+							"in":          "body",
+							"required":    true,
+							"description": "Prometheus rules file or PrometheusRule manifest",
+							"schema": map[string]interface{}{
+								"$ref": "#/definitions/ImportDocument",
+							},
+						},
+						{"$ref": "#/parameters/dryRun"},
+					},
+					"responses": map[string]interface{}{
+						"201": map[string]interface{}{
+							"description": "AlertRule created",
+						},
+						"400": map[string]interface{}{
+							"description": "Neither a rules file nor a PrometheusRule, or uses fields an AlertRule can't hold, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"409": map[string]interface{}{
+							"description": "AlertRule already exists",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/namespaces/{namespace}/alertrules:export": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "Export AlertRules in namespace",
+					"description": "Render the matching AlertRules in the namespace as one Prometheus rule file, or a file each with archive=tar",
+					"produces":    []string{"application/yaml", "application/x-tar"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{"$ref": "#/parameters/labelSelector"},
+						{"$ref": "#/parameters/fieldSelector"},
+						{"$ref": "#/parameters/exportFormat"},
+						{"$ref": "#/parameters/exportArchive"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Prometheus rule file, or a tar of rule files with archive=tar",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid parameters, or a group name repeats without archive=tar",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/namespaces/{namespace}/alertrules/{name}/export": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "Export AlertRule",
+					"description": "Render the AlertRule as a Prometheus rule file, converted as for the generated PrometheusRule",
+					"produces":    []string{"application/yaml", "application/x-tar"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{"$ref": "#/parameters/exportFormat"},
+						{"$ref": "#/parameters/exportArchive"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Prometheus rule file, or a tar of rule files with archive=tar",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid format or archive",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/namespaces/{namespace}/alertrules/{name}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "Get AlertRule",
+					"description": "Get a specific AlertRule",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "AlertRule details",
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+				"put": map[string]interface{}{
+					"summary":     "Update AlertRule",
+					"description": "Update an existing AlertRule",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{
+							"name":        "body",
+							"in":          "body",
+							"required":    true,
+							"description": "Updated AlertRule object",
+							"schema": map[string]interface{}{
+								"$ref": "#/definitions/AlertRule",
+							},
+						},
+						{"$ref": "#/parameters/dryRun"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "AlertRule updated",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid request, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+				"patch": map[string]interface{}{
+					"summary":     "Patch AlertRule",
+					"description": "Apply a JSON merge patch, JSON patch or strategic merge patch to an AlertRule",
+					"consumes": []string{
+						"application/merge-patch+json",
+						"application/json-patch+json",
+						"application/strategic-merge-patch+json",
+					},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{
+							"name":        "body",
+							"in":          "body",
+							"required":    true,
+							"description": "Patch in the format given by Content-Type",
+							"schema": map[string]interface{}{
+								"type": "object",
+							},
+						},
+						{"$ref": "#/parameters/dryRun"},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "AlertRule patched",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid patch, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"409": map[string]interface{}{
+							"description": "AlertRule changed while the patch was applied",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"415": map[string]interface{}{
+							"description": "Unsupported patch content type",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+				"delete": map[string]interface{}{
+					"summary":     "Delete AlertRule",
+					"description": "Delete an AlertRule",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+					},
+					"responses": map[string]interface{}{
+						"204": map[string]interface{}{
+							"description": "AlertRule deleted",
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+			},
+			"/namespaces/{namespace}/alertrules/{name}/events": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "List AlertRule events",
+					"description": "List the Kubernetes Events recorded for an AlertRule, oldest first",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "API server is healthy",
+							"description": "List of Events",
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 			},
-			"/alertrules": map[string]interface{}{
-				"get": map[string]interface{}{
-					"summary":     "List all AlertRules",
-					"description": "List all AlertRules across all namespaces",
+			"/namespaces/{namespace}/alertrules/{name}/preview": map[string]interface{}{
+				"post": map[string]interface{}{
+					"summary":     "Preview PrometheusRule",
+					"description": "Render the PrometheusRule for the AlertRule in the body, or the stored one without a body, and diff it against the live PrometheusRule",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{
+							"name":        "body",
+							"in":          "body",
+							"required":    false,
+							"description": "Proposed AlertRule",
+							"schema": map[string]interface{}{
+								"$ref": "#/definitions/AlertRule",
+							},
+						},
+					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "List of AlertRules",
+							"description": "Rendered PrometheusRule with the action and changes an apply would make",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Preview"},
+						},
+						"404": map[string]interface{}{
+							"description": "No body was sent and the AlertRule doesn't exist",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"400": map[string]interface{}{
+							"description": "AlertRule fails validation, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 			},
-			"/namespaces/{namespace}/alertrules": map[string]interface{}{
+			"/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules": map[string]interface{}{
 				"get": map[string]interface{}{
-					"summary":     "List AlertRules in namespace",
-					"description": "List all AlertRules in a specific namespace",
+					"summary":     "List rules",
+					"description": "List the alerting and recording rules of a group",
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "namespace",
@@ -48,16 +690,34 @@ func getOpenAPISpec() map[string]interface{} {
 							"type":        "string",
 							"description": "Namespace name",
 						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{
+							"name":        "group",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Rule group name, with a / escaped as %2F",
+						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "List of AlertRules",
+							"description": "Rules of the group",
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule or rule group not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 				"post": map[string]interface{}{
-					"summary":     "Create AlertRule",
-					"description": "Create a new AlertRule in the namespace",
+					"summary":     "Add rule",
+					"description": "Append an alerting or recording rule to a group; alert names are unique within a group",
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "namespace",
@@ -66,33 +726,59 @@ func getOpenAPISpec() map[string]interface{} {
 							"type":        "string",
 							"description": "Namespace name",
 						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{
+							"name":        "group",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Rule group name, with a / escaped as %2F",
+						},
 						{
 							"name":        "body",
 							"in":          "body",
 							"required":    true,
-							"description": "AlertRule object",
+							"description": "Rule to add",
 							"schema": map[string]interface{}{
-								"$ref": "#/definitions/AlertRule",
+								"$ref": "#/definitions/Rule",
 							},
 						},
+						{"$ref": "#/parameters/dryRun"},
 					},
 					"responses": map[string]interface{}{
 						"201": map[string]interface{}{
-							"description": "AlertRule created",
+							"description": "Rule as stored, with defaults applied",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Rule"},
 						},
 						"400": map[string]interface{}{
-							"description": "Invalid request",
+							"description": "Invalid request, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule or rule group not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 						"409": map[string]interface{}{
-							"description": "AlertRule already exists",
+							"description": "An alert with the name already exists in the group",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 			},
-			"/namespaces/{namespace}/alertrules/{name}": map[string]interface{}{
+			"/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}": map[string]interface{}{
 				"get": map[string]interface{}{
-					"summary":     "Get AlertRule",
-					"description": "Get a specific AlertRule",
+					"summary":     "Get rule",
+					"description": "Get an alerting rule by group and alert name",
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "namespace",
@@ -108,19 +794,101 @@ func getOpenAPISpec() map[string]interface{} {
 							"type":        "string",
 							"description": "AlertRule name",
 						},
+						{
+							"name":        "group",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Rule group name, with a / escaped as %2F",
+						},
+						{
+							"name":        "alert",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Alert name",
+						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "AlertRule details",
+							"description": "Alerting rule",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Rule"},
 						},
 						"404": map[string]interface{}{
-							"description": "AlertRule not found",
+							"description": "AlertRule, rule group or alert not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+					},
+				},
+				"post": map[string]interface{}{
+					"summary":     "Add alerting rule",
+					"description": "Add an alerting rule with the alert name in the path to a group",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "namespace",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Namespace name",
+						},
+						{
+							"name":        "name",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "AlertRule name",
+						},
+						{
+							"name":        "group",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Rule group name, with a / escaped as %2F",
+						},
+						{
+							"name":        "alert",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Alert name",
+						},
+						{
+							"name":        "body",
+							"in":          "body",
+							"required":    true,
+							"description": "Rule to add, its alert must match the path if set",
+							"schema": map[string]interface{}{
+								"$ref": "#/definitions/Rule",
+							},
+						},
+						{"$ref": "#/parameters/dryRun"},
+					},
+					"responses": map[string]interface{}{
+						"201": map[string]interface{}{
+							"description": "Rule as stored, with defaults applied",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Rule"},
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid request, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"404": map[string]interface{}{
+							"description": "AlertRule or rule group not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"409": map[string]interface{}{
+							"description": "The alert already exists in the group",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 				"put": map[string]interface{}{
-					"summary":     "Update AlertRule",
-					"description": "Update an existing AlertRule",
+					"summary":     "Replace rule",
+					"description": "Replace an alerting rule; the alert can't be renamed",
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "namespace",
@@ -136,31 +904,53 @@ func getOpenAPISpec() map[string]interface{} {
 							"type":        "string",
 							"description": "AlertRule name",
 						},
+						{
+							"name":        "group",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Rule group name, with a / escaped as %2F",
+						},
+						{
+							"name":        "alert",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Alert name",
+						},
 						{
 							"name":        "body",
 							"in":          "body",
 							"required":    true,
-							"description": "Updated AlertRule object",
+							"description": "Replacement rule, its alert must match the path if set",
 							"schema": map[string]interface{}{
-								"$ref": "#/definitions/AlertRule",
+								"$ref": "#/definitions/Rule",
 							},
 						},
+						{"$ref": "#/parameters/dryRun"},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "AlertRule updated",
+							"description": "Rule as stored, with defaults applied",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Rule"},
 						},
 						"400": map[string]interface{}{
-							"description": "Invalid request",
+							"description": "Invalid request, or the AlertRule fails validation with reason Invalid, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 						"404": map[string]interface{}{
-							"description": "AlertRule not found",
+							"description": "AlertRule, rule group or alert not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 				"delete": map[string]interface{}{
-					"summary":     "Delete AlertRule",
-					"description": "Delete an AlertRule",
+					"summary":     "Remove rule",
+					"description": "Remove an alerting rule from its group",
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "namespace",
@@ -176,19 +966,105 @@ func getOpenAPISpec() map[string]interface{} {
 							"type":        "string",
 							"description": "AlertRule name",
 						},
+						{
+							"name":        "group",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Rule group name, with a / escaped as %2F",
+						},
+						{
+							"name":        "alert",
+							"in":          "path",
+							"required":    true,
+							"type":        "string",
+							"description": "Alert name",
+						},
+						{"$ref": "#/parameters/dryRun"},
 					},
 					"responses": map[string]interface{}{
 						"204": map[string]interface{}{
-							"description": "AlertRule deleted",
+							"description": "Rule removed",
 						},
 						"404": map[string]interface{}{
-							"description": "AlertRule not found",
+							"description": "AlertRule, rule group or alert not found",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"412": map[string]interface{}{
+							"description": "If-Match doesn't match the current ETag",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
+						},
+						"400": map[string]interface{}{
+							"description": "AlertRule fails validation, details.causes names the invalid fields",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Status"},
 						},
 					},
 				},
 			},
 		},
 		"definitions": map[string]interface{}{
+			"Status": map[string]interface{}{
+				"type":        "object",
+				"description": "Kubernetes meta/v1 Status returned for every failed request",
+				"properties": map[string]interface{}{
+					"kind":       map[string]interface{}{"type": "string"},
+					"apiVersion": map[string]interface{}{"type": "string"},
+					"status":     map[string]interface{}{"type": "string"},
+					"message":    map[string]interface{}{"type": "string"},
+					"reason": map[string]interface{}{
+						"type":        "string",
+						"description": "Machine-readable reason such as NotFound, Conflict or Invalid",
+					},
+					"details": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"name":  map[string]interface{}{"type": "string"},
+							"group": map[string]interface{}{"type": "string"},
+							"kind":  map[string]interface{}{"type": "string"},
+							"causes": map[string]interface{}{
+								"type": "array",
+								"items": map[string]interface{}{
+									"type": "object",
+									"properties": map[string]interface{}{
+										"reason":  map[string]interface{}{"type": "string"},
+										"message": map[string]interface{}{"type": "string"},
+										"field":   map[string]interface{}{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+					"code":      map[string]interface{}{"type": "integer"},
+					"requestID": map[string]interface{}{"type": "string", "description": "ID of the request, also returned in the X-Request-ID header"},
+				},
+			},
+			"Preview": map[string]interface{}{
+				"type":        "object",
+				"description": "PrometheusRule the operator would generate for an AlertRule, and how it differs from the live one",
+				"properties": map[string]interface{}{
+					"action": map[string]interface{}{
+						"type":        "string",
+						"description": "What the operator would do to the live PrometheusRule",
+						"enum":        []string{"Create", "Update", "None"},
+					},
+					"prometheusRule": map[string]interface{}{
+						"type":        "object",
+						"description": "The PrometheusRule the operator would apply",
+					},
+					"changes": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"path": map[string]interface{}{"type": "string", "description": "Field that changes, e.g. spec.groups[cpu.rules].rules[HighCPUUsage].expr"},
+								"type": map[string]interface{}{"type": "string", "enum": []string{"Added", "Removed", "Modified"}},
+								"old":  map[string]interface{}{"description": "Live value"},
+								"new":  map[string]interface{}{"description": "Generated value"},
+							},
+						},
+					},
+				},
+			},
 			"AlertRule": map[string]interface{}{
 				"type":     "object",
 				"required": []string{"metadata", "spec"},
@@ -232,6 +1108,97 @@ func getOpenAPISpec() map[string]interface{} {
 									"type": "string",
 								},
 							},
+							"driftPolicy": map[string]interface{}{
+								"type":        "string",
+								"description": "Whether changes made directly to the PrometheusRule are reverted or only reported",
+								"enum":        []string{"Revert", "Report"},
+								"default":     "Revert",
+							},
+						},
+					},
+				},
+			},
+			"BatchRequest": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"operations"},
+				"properties": map[string]interface{}{
+					"operations": map[string]interface{}{
+						"type":        "array",
+						"maxItems":    1000,
+						"description": "Operations to run, no two may name the same AlertRule",
+						"items": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"op"},
+							"properties": map[string]interface{}{
+								"op":        map[string]interface{}{"type": "string", "enum": []string{"create", "upsert", "delete"}},
+								"namespace": map[string]interface{}{"type": "string"},
+								"name":      map[string]interface{}{"type": "string"},
+								"alertRule": map[string]interface{}{"$ref": "#/definitions/AlertRule"},
+							},
+						},
+					},
+					"atomic":      map[string]interface{}{"type": "boolean", "description": "Roll back the applied operations and skip the rest if any fails. An atomic batch can't hold deletes."},
+					"concurrency": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 50, "default": 10},
+				},
+			},
+			"BatchResponse": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"results": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"op":        map[string]interface{}{"type": "string"},
+								"namespace": map[string]interface{}{"type": "string"},
+								"name":      map[string]interface{}{"type": "string"},
+								"result":    map[string]interface{}{"type": "string", "enum": []string{"Succeeded", "Failed", "Skipped", "RolledBack", "RollbackFailed"}},
+								"code":      map[string]interface{}{"type": "integer"},
+								"status":    map[string]interface{}{"$ref": "#/definitions/Status"},
+								"alertRule": map[string]interface{}{"$ref": "#/definitions/AlertRule"},
+							},
+						},
+					},
+					"succeeded":  map[string]interface{}{"type": "integer"},
+					"failed":     map[string]interface{}{"type": "integer"},
+					"rolledBack": map[string]interface{}{"type": "boolean"},
+				},
+			},
+			"SearchResponse": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"results": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"namespace": map[string]interface{}{"type": "string"},
+								"alertRule": map[string]interface{}{"type": "string"},
+								"group":     map[string]interface{}{"type": "string"},
+								"rule":      map[string]interface{}{"$ref": "#/definitions/Rule"},
+							},
+						},
+					},
+				},
+			},
+			"ImportDocument": map[string]interface{}{
+				"type":        "object",
+				"description": "Prometheus rules file with groups, or a PrometheusRule manifest with spec.groups",
+				"properties": map[string]interface{}{
+					"groups": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"$ref": "#/definitions/AlertGroup"},
+					},
+					"apiVersion": map[string]interface{}{"type": "string"},
+					"kind":       map[string]interface{}{"type": "string", "enum": []string{"PrometheusRule"}},
+					"metadata":   map[string]interface{}{"type": "object"},
+					"spec": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"groups": map[string]interface{}{
+								"type":  "array",
+								"items": map[string]interface{}{"$ref": "#/definitions/AlertGroup"},
+							},
 						},
 					},
 				},
@@ -250,7 +1217,7 @@ func getOpenAPISpec() map[string]interface{} {
 					},
 					"rules": map[string]interface{}{
 						"type":        "array",
-						"description": "Alert rules",
+						"description": "Alerting and recording rules",
 						"items": map[string]interface{}{
 							"$ref": "#/definitions/Rule",
 						},
@@ -258,20 +1225,25 @@ func getOpenAPISpec() map[string]interface{} {
 				},
 			},
 			"Rule": map[string]interface{}{
-				"type":     "object",
-				"required": []string{"alert", "expr"},
+				"type":        "object",
+				"description": "Alerting or recording rule. Exactly one of alert or record must be set",
+				"required":    []string{"expr"},
 				"properties": map[string]interface{}{
 					"alert": map[string]interface{}{
 						"type":        "string",
 						"description": "Alert name",
 					},
+					"record": map[string]interface{}{
+						"type":        "string",
+						"description": "Name of the time series to output to for a recording rule",
+					},
 					"expr": map[string]interface{}{
 						"type":        "string",
 						"description": "PromQL expression to evaluate",
 					},
 					"for": map[string]interface{}{
 						"type":        "string",
-						"description": "How long the alert must be pending before firing",
+						"description": "How long the alert must be pending before firing (alerting rules only)",
 					},
 					"labels": map[string]interface{}{
 						"type":        "object",
@@ -282,7 +1254,7 @@ func getOpenAPISpec() map[string]interface{} {
 					},
 					"annotations": map[string]interface{}{
 						"type":        "object",
-						"description": "Annotations to add",
+						"description": "Annotations to add (alerting rules only)",
 						"additionalProperties": map[string]interface{}{
 							"type": "string",
 						},
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
+)
+
+// isDryRun reads the dryRun query parameter of a write. As with the Kubernetes API, All
+// is the only value: the request is validated and admitted but nothing is stored.
+func isDryRun(r *http.Request) (bool, error) {
+	values := r.URL.Query()["dryRun"]
+	for _, value := range values {
+		if value != metav1.DryRunAll {
+			return false, errors.NewBadRequest(fmt.Sprintf("invalid dryRun %q: only %s is supported", value, metav1.DryRunAll))
+		}
+	}
+	return len(values) > 0, nil
+}
+
+// Preview actions
+const (
+	PreviewActionCreate = "Create"
+	PreviewActionUpdate = "Update"
+	PreviewActionNone   = "None"
+)
+
+// Preview is the PrometheusRule the operator would generate for an AlertRule, and how it
+// differs from the live one
+type Preview struct {
+	// Action is what the operator would do to the live PrometheusRule: Create, Update or None
+	Action string `json:"action"`
+
+	// PrometheusRule is the PrometheusRule the operator would apply
+	PrometheusRule *monitoringv1.PrometheusRule `json:"prometheusRule"`
+
+	// Changes are the fields the apply would change on the live PrometheusRule
+	Changes []Change `json:"changes"`
+}
+
+// Change types
+const (
+	ChangeAdded    = "Added"
+	ChangeRemoved  = "Removed"
+	ChangeModified = "Modified"
+)
+
+// Change is one field that differs between the live and the generated PrometheusRule
+type Change struct {
+	// Path names the field. Groups and rules are identified by name where the names are
+	// unique, e.g. spec.groups[cpu.rules].rules[HighCPUUsage].expr, and by index otherwise.
+	Path string `json:"path"`
+
+	// Type is Added, Removed or Modified
+	Type string `json:"type"`
+
+	// Old and New are the live and generated values of the field
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// previewAlertRule renders the PrometheusRule for the AlertRule in the request body, or
+// for the stored AlertRule without a body, and compares it with the live one. The caller
+// needs get on both the AlertRule and the PrometheusRule. Nothing is written.
+func (s *Server) previewAlertRule(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if !s.authorize(w, r, "get", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	existing := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, existing); err != nil {
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
+			writeError(w, r, err)
+			return
+		}
+		// Previewing a new AlertRule needs its spec in the body
+		if len(bytes.TrimSpace(body)) == 0 {
+			writeError(w, r, err)
+			return
+		}
+		existing = nil
+	}
+
+	alertRule := existing
+	if len(bytes.TrimSpace(body)) > 0 {
+		alertRule = &monitoringv1alpha1.AlertRule{}
+		if err := json.Unmarshal(body, alertRule); err != nil {
+			writeError(w, r, errors.NewBadRequest(fmt.Sprintf("Invalid request body: %v", err)))
+			return
+		}
+		alertRule.Name = name
+		alertRule.Namespace = namespace
+		if existing != nil {
+			alertRule.UID = existing.UID
+		}
+	}
+
+	validation.SetDefaults(&alertRule.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&alertRule.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&alertRule.Spec), metrics.SourceAPI).Inc()
+		writeError(w, r, newInvalid(name, errs))
+		return
+	}
+
+	prometheusRule := render.GeneratePrometheusRule(alertRule)
+	if alertRule.UID != "" {
+		prometheusRule.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(alertRule, monitoringv1alpha1.GroupVersion.WithKind("AlertRule")),
+		}
+	}
+
+	// The live PrometheusRule is read with the operator's service account, so the caller
+	// must be allowed to read it themselves before it is returned in the changes
+	if !s.authorize(w, r, "get", prometheusRulesResource, namespace, prometheusRule.Name) {
+		return
+	}
+
+	preview := &Preview{PrometheusRule: prometheusRule}
+	live := &monitoringv1.PrometheusRule{}
+	if err := s.client.Get(ctx, client.ObjectKeyFromObject(prometheusRule), live); err != nil {
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get PrometheusRule")
+			writeError(w, r, err)
+			return
+		}
+		live = nil
+	}
+
+	preview.Changes, err = diffPrometheusRules(live, prometheusRule)
+	if err != nil {
+		s.logFor(r).Error(err, "Failed to compare PrometheusRules")
+		writeError(w, r, err)
+		return
+	}
+	switch {
+	case live == nil:
+		preview.Action = PreviewActionCreate
+	case len(preview.Changes) > 0:
+		preview.Action = PreviewActionUpdate
+	default:
+		preview.Action = PreviewActionNone
+	}
+
+	s.writeObject(w, r, http.StatusOK, preview)
+}
+
+// diffPrometheusRules compares the fields the operator applies: the labels it sets and
+// the spec. Labels other tools added to the live object are left alone by the apply, so
+// they aren't reported. A nil live PrometheusRule doesn't exist yet.
+func diffPrometheusRules(live, desired *monitoringv1.PrometheusRule) ([]Change, error) {
+	liveLabels, desiredLabels := map[string]string{}, map[string]string{}
+	for k, v := range desired.Labels {
+		desiredLabels[k] = v
+	}
+	liveSpec := monitoringv1.PrometheusRuleSpec{}
+	if live != nil {
+		for k := range desired.Labels {
+			if v, ok := live.Labels[k]; ok {
+				liveLabels[k] = v
+			}
+		}
+		liveSpec = live.Spec
+	}
+
+	changes := []Change{}
+	for _, field := range []struct {
+		path          string
+		live, desired interface{}
+	}{
+		{"metadata.labels", liveLabels, desiredLabels},
+		{"spec", liveSpec, desired.Spec},
+	} {
+		old, err := toJSONValue(field.live)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := toJSONValue(field.desired)
+		if err != nil {
+			return nil, err
+		}
+		diffValues(field.path, old, updated, &changes)
+	}
+	return changes, nil
+}
+
+// toJSONValue converts v to the maps, slices and scalars of its JSON form
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// diffValues appends the differences between two JSON values to changes
+func diffValues(path string, old, updated interface{}, changes *[]Change) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	updatedMap, updatedIsMap := updated.(map[string]interface{})
+	if oldIsMap && updatedIsMap {
+		keys := make([]string, 0, len(oldMap)+len(updatedMap))
+		for k := range oldMap {
+			keys = append(keys, k)
+		}
+		for k := range updatedMap {
+			if _, ok := oldMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffEntry(fieldPath(path, k), oldMap[k], updatedMap[k], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	updatedList, updatedIsList := updated.([]interface{})
+	if oldIsList && updatedIsList {
+		diffLists(path, oldList, updatedList, changes)
+		return
+	}
+
+	if !reflect.DeepEqual(old, updated) {
+		*changes = append(*changes, Change{Path: path, Type: ChangeModified, Old: old, New: updated})
+	}
+}
+
+// diffEntry compares a map entry or list item, either of which may be missing
+func diffEntry(path string, old, updated interface{}, changes *[]Change) {
+	switch {
+	case old == nil && updated == nil:
+	case old == nil:
+		*changes = append(*changes, Change{Path: path, Type: ChangeAdded, New: updated})
+	case updated == nil:
+		*changes = append(*changes, Change{Path: path, Type: ChangeRemoved, Old: old})
+	default:
+		diffValues(path, old, updated, changes)
+	}
+}
+
+// diffLists matches the items of two lists by name where they have unique names, as
+// rule groups and rules do, and by index otherwise
+func diffLists(path string, old, updated []interface{}, changes *[]Change) {
+	oldNames, oldNamed := itemNames(old)
+	updatedNames, updatedNamed := itemNames(updated)
+	if !oldNamed || !updatedNamed {
+		for i := 0; i < len(old) || i < len(updated); i++ {
+			var oldItem, updatedItem interface{}
+			if i < len(old) {
+				oldItem = old[i]
+			}
+			if i < len(updated) {
+				updatedItem = updated[i]
+			}
+			diffEntry(path+"["+strconv.Itoa(i)+"]", oldItem, updatedItem, changes)
+		}
+		return
+	}
+
+	oldByName := make(map[string]interface{}, len(old))
+	for i, name := range oldNames {
+		oldByName[name] = old[i]
+	}
+	updatedByName := make(map[string]bool, len(updated))
+	for i, name := range updatedNames {
+		updatedByName[name] = true
+		diffEntry(path+"["+name+"]", oldByName[name], updated[i], changes)
+	}
+	for i, name := range oldNames {
+		if !updatedByName[name] {
+			diffEntry(path+"["+name+"]", old[i], nil, changes)
+		}
+	}
+}
+
+// itemNames returns the name of each list item: the name of a rule group, or the alert
+// or record of a rule. ok is false unless every item has a unique name.
+func itemNames(items []interface{}) (names []string, ok bool) {
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		fields, isMap := item.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		var name string
+		for _, key := range []string{"name", "alert", "record"} {
+			if value, isString := fields[key].(string); isString && value != "" {
+				name = value
+				break
+			}
+		}
+		if name == "" || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, true
+}
+
+// plainKey matches map keys that can be written after a dot in a path
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fieldPath appends a map key to a path, quoting keys like app.kubernetes.io/name
+func fieldPath(path, key string) string {
+	if plainKey.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
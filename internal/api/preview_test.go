@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// previewRule returns a PrometheusRule with the given groups
+func previewRule(groups ...monitoringv1.RuleGroup) *monitoringv1.PrometheusRule {
+	return &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "kneutral-cpu", Namespace: "monitoring"},
+		Spec:       monitoringv1.PrometheusRuleSpec{Groups: groups},
+	}
+}
+
+// previewGroup returns a rule group with the given rules
+func previewGroup(name string, rules ...monitoringv1.Rule) monitoringv1.RuleGroup {
+	return monitoringv1.RuleGroup{Name: name, Rules: rules}
+}
+
+// previewAlert returns an alerting rule
+func previewAlert(alert, expr string) monitoringv1.Rule {
+	return monitoringv1.Rule{Alert: alert, Expr: intstr.FromString(expr)}
+}
+
+// changePaths returns the type and path of each change, in order
+func changePaths(changes []Change) []string {
+	paths := []string{}
+	for _, change := range changes {
+		paths = append(paths, change.Type+" "+change.Path)
+	}
+	return paths
+}
+
+func TestDiffPrometheusRules(t *testing.T) {
+	cpu := previewGroup("cpu.rules", previewAlert("HighCPU", "cpu > 80"), previewAlert("CriticalCPU", "cpu > 95"))
+	memory := previewGroup("memory.rules", previewAlert("HighMemory", "memory > 80"))
+
+	tests := []struct {
+		name          string
+		live, desired *monitoringv1.PrometheusRule
+		want          []string
+	}{
+		{
+			name:    "unchanged",
+			live:    previewRule(cpu, memory),
+			desired: previewRule(cpu, memory),
+			want:    []string{},
+		},
+		{
+			name:    "groups reordered",
+			live:    previewRule(cpu, memory),
+			desired: previewRule(memory, cpu),
+			want:    []string{},
+		},
+		{
+			name:    "rules reordered",
+			live:    previewRule(cpu),
+			desired: previewRule(previewGroup("cpu.rules", cpu.Rules[1], cpu.Rules[0])),
+			want:    []string{},
+		},
+		{
+			name:    "group renamed",
+			live:    previewRule(cpu, memory),
+			desired: previewRule(previewGroup("processor.rules", cpu.Rules...), memory),
+			want:    []string{"Added spec.groups[processor.rules]", "Removed spec.groups[cpu.rules]"},
+		},
+		{
+			name:    "rule renamed",
+			live:    previewRule(cpu),
+			desired: previewRule(previewGroup("cpu.rules", previewAlert("HighCPUUsage", "cpu > 80"), cpu.Rules[1])),
+			want:    []string{"Added spec.groups[cpu.rules].rules[HighCPUUsage]", "Removed spec.groups[cpu.rules].rules[HighCPU]"},
+		},
+		{
+			name:    "expression changed",
+			live:    previewRule(cpu),
+			desired: previewRule(previewGroup("cpu.rules", previewAlert("HighCPU", "cpu > 85"), cpu.Rules[1])),
+			want:    []string{"Modified spec.groups[cpu.rules].rules[HighCPU].expr"},
+		},
+		{
+			name: "repeated recording rules are matched by index",
+			live: previewRule(previewGroup("cpu.rules",
+				monitoringv1.Rule{Record: "cpu:ratio", Expr: intstr.FromString("a")},
+				monitoringv1.Rule{Record: "cpu:ratio", Expr: intstr.FromString("b")})),
+			desired: previewRule(previewGroup("cpu.rules",
+				monitoringv1.Rule{Record: "cpu:ratio", Expr: intstr.FromString("b")},
+				monitoringv1.Rule{Record: "cpu:ratio", Expr: intstr.FromString("a")})),
+			want: []string{"Modified spec.groups[cpu.rules].rules[0].expr", "Modified spec.groups[cpu.rules].rules[1].expr"},
+		},
+		{
+			name:    "new PrometheusRule",
+			desired: previewRule(cpu),
+			want:    []string{"Added spec.groups"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := diffPrometheusRules(tt.live, tt.desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := changePaths(changes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffPrometheusRulesLabels(t *testing.T) {
+	live := previewRule()
+	live.Labels = map[string]string{"app.kubernetes.io/managed-by": "kneutral-operator", "team": "platform", "added-by": "kubectl"}
+	desired := previewRule()
+	desired.Labels = map[string]string{"app.kubernetes.io/managed-by": "kneutral-operator", "team": "sre", "prometheus": "main"}
+
+	changes, err := diffPrometheusRules(live, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Labels the operator doesn't set are left alone by the apply, so aren't reported
+	want := []Change{
+		{Path: "metadata.labels.prometheus", Type: ChangeAdded, New: "main"},
+		{Path: "metadata.labels.team", Type: ChangeModified, Old: "platform", New: "sre"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+
+	if path := fieldPath("metadata.labels", "app.kubernetes.io/name"); path != `metadata.labels["app.kubernetes.io/name"]` {
+		t.Errorf("path = %s, want the key quoted", path)
+	}
+}
+
+func TestPreviewAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  permissions
+		wantCode int
+	}{
+		{
+			name:     "AlertRule and PrometheusRule",
+			allowed:  permissions{"get alertrules": true, "get prometheusrules": true},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "AlertRule only",
+			allowed:  permissions{"get alertrules": true},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "PrometheusRule only",
+			allowed:  permissions{"get prometheusrules": true},
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAuthorizedTestServer(t, tt.allowed)
+
+			rec := serve(s, http.MethodPost, "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/preview", "", nil)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			preview := &Preview{}
+			if err := json.Unmarshal(rec.Body.Bytes(), preview); err != nil {
+				t.Fatal(err)
+			}
+			if preview.Action != PreviewActionNone {
+				t.Errorf("action = %s, want %s for the stored AlertRule: %+v", preview.Action, PreviewActionNone, preview.Changes)
+			}
+		})
+	}
+}
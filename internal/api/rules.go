@@ -0,0 +1,307 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
+)
+
+// parseRulePath reads the group and alert of a path of the form
+// .../alertrules/{name}/groups/{group}/rules[/{alert}]. The escaped path is split, so
+// group names may contain an escaped slash. alert is empty for the rules of a group.
+func parseRulePath(r *http.Request) (group, alert string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v1/namespaces/"), "/")
+	if len(parts) < 6 || len(parts) > 7 || parts[3] != "groups" || parts[5] != "rules" {
+		return "", "", false
+	}
+	group, err := url.PathUnescape(parts[4])
+	if err != nil || group == "" {
+		return "", "", false
+	}
+	if len(parts) == 7 {
+		if alert, err = url.PathUnescape(parts[6]); err != nil || alert == "" {
+			return "", "", false
+		}
+	}
+	return group, alert, true
+}
+
+// handleRules handles the rules of an AlertRule's group: the group's rules as a
+// collection, and its alerting rules by alert name. Recording rules may share a name,
+// so only the collection covers them.
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	group, alert, ok := parseRulePath(r)
+	if !ok {
+		writeError(w, r, errors.NewBadRequest(invalidPathMessage))
+		return
+	}
+	if alert == "" {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules")
+	} else {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}")
+	}
+
+	switch {
+	case alert == "" && r.Method == http.MethodGet:
+		s.listRules(w, r, namespace, name, group)
+	case alert == "" && r.Method == http.MethodPost:
+		s.createRule(w, r, namespace, name, group, "")
+	case alert != "" && r.Method == http.MethodGet:
+		s.getRule(w, r, namespace, name, group, alert)
+	case alert != "" && r.Method == http.MethodPost:
+		s.createRule(w, r, namespace, name, group, alert)
+	case alert != "" && r.Method == http.MethodPut:
+		s.replaceRule(w, r, namespace, name, group, alert)
+	case alert != "" && r.Method == http.MethodDelete:
+		s.deleteRule(w, r, namespace, name, group, alert)
+	default:
+		writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+	}
+}
+
+// groupNotFound returns the 404 for a rule group an AlertRule doesn't have
+func groupNotFound(alertRule *monitoringv1alpha1.AlertRule, group string) error {
+	return newStatusError(http.StatusNotFound, metav1.StatusReasonNotFound,
+		fmt.Sprintf("rule group %q not found in AlertRule %s/%s", group, alertRule.Namespace, alertRule.Name))
+}
+
+// ruleNotFound returns the 404 for an alert a rule group doesn't have
+func ruleNotFound(alertRule *monitoringv1alpha1.AlertRule, group, alert string) error {
+	return newStatusError(http.StatusNotFound, metav1.StatusReasonNotFound,
+		fmt.Sprintf("alert %q not found in rule group %q of AlertRule %s/%s", alert, group, alertRule.Namespace, alertRule.Name))
+}
+
+// findGroup returns the index of the named group, or -1
+func findGroup(spec *monitoringv1alpha1.AlertRuleSpec, group string) int {
+	for i := range spec.Groups {
+		if spec.Groups[i].Name == group {
+			return i
+		}
+	}
+	return -1
+}
+
+// findAlert returns the index of the alerting rule with the given name, or -1
+func findAlert(group *monitoringv1alpha1.AlertGroup, alert string) int {
+	for i := range group.Rules {
+		if group.Rules[i].Alert == alert {
+			return i
+		}
+	}
+	return -1
+}
+
+// getAlertRuleForRules reads the AlertRule whose rules are requested, writing the
+// error response if it can't
+func (s *Server) getAlertRuleForRules(w http.ResponseWriter, r *http.Request, namespace, name string) (*monitoringv1alpha1.AlertRule, bool) {
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(r.Context(), types.NamespacedName{Namespace: namespace, Name: name}, alertRule); err != nil {
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
+		}
+		writeError(w, r, err)
+		return nil, false
+	}
+	return alertRule, true
+}
+
+// listRules lists the rules of a group, alerting and recording
+func (s *Server) listRules(w http.ResponseWriter, r *http.Request, namespace, name, group string) {
+	if !s.authorize(w, r, "get", alertRulesResource, namespace, name) {
+		return
+	}
+
+	alertRule, ok := s.getAlertRuleForRules(w, r, namespace, name)
+	if !ok {
+		return
+	}
+	i := findGroup(&alertRule.Spec, group)
+	if i < 0 {
+		writeError(w, r, groupNotFound(alertRule, group))
+		return
+	}
+
+	setETag(w, alertRule.ResourceVersion)
+	s.writeObject(w, r, http.StatusOK, alertRule.Spec.Groups[i].Rules)
+}
+
+// getRule gets an alerting rule by group and alert name
+func (s *Server) getRule(w http.ResponseWriter, r *http.Request, namespace, name, group, alert string) {
+	if !s.authorize(w, r, "get", alertRulesResource, namespace, name) {
+		return
+	}
+
+	alertRule, ok := s.getAlertRuleForRules(w, r, namespace, name)
+	if !ok {
+		return
+	}
+	i := findGroup(&alertRule.Spec, group)
+	if i < 0 {
+		writeError(w, r, groupNotFound(alertRule, group))
+		return
+	}
+	j := findAlert(&alertRule.Spec.Groups[i], alert)
+	if j < 0 {
+		writeError(w, r, ruleNotFound(alertRule, group, alert))
+		return
+	}
+
+	setETag(w, alertRule.ResourceVersion)
+	s.writeObject(w, r, http.StatusOK, alertRule.Spec.Groups[i].Rules[j])
+}
+
+// createRule adds a rule to a group. With an alert name in the path the rule is an
+// alerting rule of that name; alert names are unique within a group.
+func (s *Server) createRule(w http.ResponseWriter, r *http.Request, namespace, name, group, alert string) {
+	if !s.authorize(w, r, "update", alertRulesResource, namespace, name) {
+		return
+	}
+
+	var rule monitoringv1alpha1.Rule
+	if err := decodeBody(r, &rule); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if alert != "" {
+		if rule.Alert != "" && rule.Alert != alert {
+			writeError(w, r, newInvalid(name, field.ErrorList{field.Invalid(field.NewPath("alert"), rule.Alert,
+				"must match the alert name in the path")}))
+			return
+		}
+		rule.Alert = alert
+	}
+
+	s.updateRules(w, r, namespace, name, http.StatusCreated, func(alertRule *monitoringv1alpha1.AlertRule) (*monitoringv1alpha1.Rule, error) {
+		i := findGroup(&alertRule.Spec, group)
+		if i < 0 {
+			return nil, groupNotFound(alertRule, group)
+		}
+		rules := &alertRule.Spec.Groups[i].Rules
+		if rule.Alert != "" && findAlert(&alertRule.Spec.Groups[i], rule.Alert) >= 0 {
+			return nil, newStatusError(http.StatusConflict, metav1.StatusReasonAlreadyExists,
+				fmt.Sprintf("alert %q already exists in rule group %q of AlertRule %s/%s", rule.Alert, group, namespace, name))
+		}
+		*rules = append(*rules, rule)
+		return &(*rules)[len(*rules)-1], nil
+	})
+}
+
+// replaceRule replaces an alerting rule. The alert can't be renamed this way.
+func (s *Server) replaceRule(w http.ResponseWriter, r *http.Request, namespace, name, group, alert string) {
+	if !s.authorize(w, r, "update", alertRulesResource, namespace, name) {
+		return
+	}
+
+	var rule monitoringv1alpha1.Rule
+	if err := decodeBody(r, &rule); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if rule.Alert != "" && rule.Alert != alert {
+		writeError(w, r, newInvalid(name, field.ErrorList{field.Invalid(field.NewPath("alert"), rule.Alert,
+			"must match the alert name in the path")}))
+		return
+	}
+	rule.Alert = alert
+
+	s.updateRules(w, r, namespace, name, http.StatusOK, func(alertRule *monitoringv1alpha1.AlertRule) (*monitoringv1alpha1.Rule, error) {
+		i := findGroup(&alertRule.Spec, group)
+		if i < 0 {
+			return nil, groupNotFound(alertRule, group)
+		}
+		j := findAlert(&alertRule.Spec.Groups[i], alert)
+		if j < 0 {
+			return nil, ruleNotFound(alertRule, group, alert)
+		}
+		alertRule.Spec.Groups[i].Rules[j] = rule
+		return &alertRule.Spec.Groups[i].Rules[j], nil
+	})
+}
+
+// deleteRule removes an alerting rule. Removing the last rule of a group leaves the
+// group empty.
+func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request, namespace, name, group, alert string) {
+	if !s.authorize(w, r, "update", alertRulesResource, namespace, name) {
+		return
+	}
+
+	s.updateRules(w, r, namespace, name, http.StatusNoContent, func(alertRule *monitoringv1alpha1.AlertRule) (*monitoringv1alpha1.Rule, error) {
+		i := findGroup(&alertRule.Spec, group)
+		if i < 0 {
+			return nil, groupNotFound(alertRule, group)
+		}
+		j := findAlert(&alertRule.Spec.Groups[i], alert)
+		if j < 0 {
+			return nil, ruleNotFound(alertRule, group, alert)
+		}
+		rules := alertRule.Spec.Groups[i].Rules
+		alertRule.Spec.Groups[i].Rules = append(rules[:j:j], rules[j+1:]...)
+		return nil, nil
+	})
+}
+
+// updateRules changes the rules of an AlertRule and stores it, validated and guarded by
+// If-Match and the resourceVersion it was read at, as a PUT of the whole AlertRule
+// would be. change returns the rule to respond with, or nil for no body.
+func (s *Server) updateRules(w http.ResponseWriter, r *http.Request, namespace, name string, code int,
+	change func(*monitoringv1alpha1.AlertRule) (*monitoringv1alpha1.Rule, error)) {
+	ctx := r.Context()
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var opts []client.UpdateOption
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+
+	alertRule, ok := s.getAlertRuleForRules(w, r, namespace, name)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, alertRule.ResourceVersion) {
+		return
+	}
+
+	rule, err := change(alertRule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	validation.SetDefaults(&alertRule.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&alertRule.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&alertRule.Spec), metrics.SourceAPI).Inc()
+		writeError(w, r, newInvalid(name, errs))
+		return
+	}
+
+	if err := s.client.Update(ctx, alertRule, opts...); err != nil {
+		if !errors.IsConflict(err) && !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to update AlertRule")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, alertRule.ResourceVersion)
+	if rule == nil {
+		w.WriteHeader(code)
+		return
+	}
+	s.writeObject(w, r, code, rule)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/mock"
+)
+
+const rulesTestPath = "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/groups/cpu.rules/rules"
+
+// storedRules returns the alert or record names of the rules of a group of the stored
+// cpu-monitoring AlertRule
+func storedRules(t *testing.T, c *mock.MockClient, group string) []string {
+	t.Helper()
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "monitoring", Name: "cpu-monitoring"}, alertRule); err != nil {
+		t.Fatal(err)
+	}
+	i := findGroup(&alertRule.Spec, group)
+	if i < 0 {
+		t.Fatalf("group %s is gone", group)
+	}
+	names := []string{}
+	for _, rule := range alertRule.Spec.Groups[i].Rules {
+		if rule.Alert != "" {
+			names = append(names, rule.Alert)
+		} else {
+			names = append(names, rule.Record)
+		}
+	}
+	return names
+}
+
+func TestGetRules(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec := serve(s, http.MethodGet, rulesTestPath, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Error("list of rules has no ETag")
+	}
+	var rules []monitoringv1alpha1.Rule
+	if err := json.Unmarshal(rec.Body.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Alert != "HighCPUUsage" || rules[1].Alert != "CriticalCPUUsage" {
+		t.Errorf("rules = %+v, want HighCPUUsage and CriticalCPUUsage", rules)
+	}
+
+	rec = serve(s, http.MethodGet, rulesTestPath+"/CriticalCPUUsage", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	rule := monitoringv1alpha1.Rule{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Alert != "CriticalCPUUsage" || rule.For != "2m" || rule.Labels["severity"] != "critical" {
+		t.Errorf("rule = %+v, want CriticalCPUUsage as stored", rule)
+	}
+}
+
+func TestRulesNotFound(t *testing.T) {
+	missingGroup := "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/groups/memory.rules/rules"
+	missingAlertRule := "/api/v1/namespaces/monitoring/alertrules/missing/groups/cpu.rules/rules"
+	rule := `{"expr": "cpu > 50"}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"list of a missing group", http.MethodGet, missingGroup, ""},
+		{"get in a missing group", http.MethodGet, missingGroup + "/HighCPUUsage", ""},
+		{"create in a missing group", http.MethodPost, missingGroup, `{"alert": "HighMemory", "expr": "memory > 80"}`},
+		{"replace in a missing group", http.MethodPut, missingGroup + "/HighCPUUsage", rule},
+		{"delete in a missing group", http.MethodDelete, missingGroup + "/HighCPUUsage", ""},
+		{"get a missing rule", http.MethodGet, rulesTestPath + "/LowCPUUsage", ""},
+		{"replace a missing rule", http.MethodPut, rulesTestPath + "/LowCPUUsage", rule},
+		{"delete a missing rule", http.MethodDelete, rulesTestPath + "/LowCPUUsage", ""},
+		{"list of a missing AlertRule", http.MethodGet, missingAlertRule, ""},
+		{"create in a missing AlertRule", http.MethodPost, missingAlertRule + "/HighCPUUsage", rule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+
+			rec := serve(s, tt.method, tt.path, tt.body, nil)
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("code = %d, want 404: %s", rec.Code, rec.Body)
+			}
+			if status := decodeStatus(t, rec); status.Reason != metav1.StatusReasonNotFound {
+				t.Errorf("reason = %s, want %s", status.Reason, metav1.StatusReasonNotFound)
+			}
+			if got := storedRules(t, c, "cpu.rules"); !reflect.DeepEqual(got, []string{"HighCPUUsage", "CriticalCPUUsage"}) {
+				t.Errorf("rules = %v, want them unchanged", got)
+			}
+		})
+	}
+}
+
+func TestCreateRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantCode   int
+		wantReason metav1.StatusReason
+		wantRules  []string
+	}{
+		{
+			name:      "alert named in the body",
+			path:      rulesTestPath,
+			body:      `{"alert": "LowCPUUsage", "expr": "cpu < 5"}`,
+			wantCode:  http.StatusCreated,
+			wantRules: []string{"HighCPUUsage", "CriticalCPUUsage", "LowCPUUsage"},
+		},
+		{
+			name:      "alert named in the path",
+			path:      rulesTestPath + "/LowCPUUsage",
+			body:      `{"expr": "cpu < 5"}`,
+			wantCode:  http.StatusCreated,
+			wantRules: []string{"HighCPUUsage", "CriticalCPUUsage", "LowCPUUsage"},
+		},
+		{
+			name:      "recording rule",
+			path:      rulesTestPath,
+			body:      `{"record": "instance:cpu:ratio", "expr": "avg by (instance) (cpu)"}`,
+			wantCode:  http.StatusCreated,
+			wantRules: []string{"HighCPUUsage", "CriticalCPUUsage", "instance:cpu:ratio"},
+		},
+		{
+			name:       "existing alert",
+			path:       rulesTestPath,
+			body:       `{"alert": "HighCPUUsage", "expr": "cpu > 50"}`,
+			wantCode:   http.StatusConflict,
+			wantReason: metav1.StatusReasonAlreadyExists,
+			wantRules:  []string{"HighCPUUsage", "CriticalCPUUsage"},
+		},
+		{
+			name:       "existing alert named in the path",
+			path:       rulesTestPath + "/CriticalCPUUsage",
+			body:       `{"expr": "cpu > 50"}`,
+			wantCode:   http.StatusConflict,
+			wantReason: metav1.StatusReasonAlreadyExists,
+			wantRules:  []string{"HighCPUUsage", "CriticalCPUUsage"},
+		},
+		{
+			name:       "body and path name different alerts",
+			path:       rulesTestPath + "/LowCPUUsage",
+			body:       `{"alert": "IdleCPU", "expr": "cpu < 5"}`,
+			wantCode:   http.StatusBadRequest,
+			wantReason: metav1.StatusReasonInvalid,
+			wantRules:  []string{"HighCPUUsage", "CriticalCPUUsage"},
+		},
+		{
+			name:       "invalid expression",
+			path:       rulesTestPath,
+			body:       `{"alert": "LowCPUUsage", "expr": "cpu <"}`,
+			wantCode:   http.StatusBadRequest,
+			wantReason: metav1.StatusReasonInvalid,
+			wantRules:  []string{"HighCPUUsage", "CriticalCPUUsage"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+
+			rec := serve(s, http.MethodPost, tt.path, tt.body, nil)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantReason != "" {
+				if status := decodeStatus(t, rec); status.Reason != tt.wantReason {
+					t.Errorf("reason = %s, want %s", status.Reason, tt.wantReason)
+				}
+			}
+			if got := storedRules(t, c, "cpu.rules"); !reflect.DeepEqual(got, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", got, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestReplaceRule(t *testing.T) {
+	s, c := newTestServer(t)
+
+	rec := serve(s, http.MethodPut, rulesTestPath+"/HighCPUUsage", `{"expr": "cpu > 85", "for": "10m"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	rule := monitoringv1alpha1.Rule{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rule); err != nil {
+		t.Fatal(err)
+	}
+	// The replaced rule gets the default severity, like a rule in a PUT of the AlertRule
+	if rule.Alert != "HighCPUUsage" || rule.Expr != "cpu > 85" || rule.For != "10m" || rule.Labels["severity"] != "warning" {
+		t.Errorf("rule = %+v, want the replacement with defaults", rule)
+	}
+
+	// An alert can't be renamed, since it would then be a different rule
+	rec = serve(s, http.MethodPut, rulesTestPath+"/HighCPUUsage", `{"alert": "HighCPU", "expr": "cpu > 85"}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("code of a rename = %d, want 400: %s", rec.Code, rec.Body)
+	}
+
+	// The rejected rename left the rules alone
+	if got := storedRules(t, c, "cpu.rules"); !reflect.DeepEqual(got, []string{"HighCPUUsage", "CriticalCPUUsage"}) {
+		t.Errorf("rules = %v, want HighCPUUsage and CriticalCPUUsage", got)
+	}
+}
+
+func TestDeleteLastRule(t *testing.T) {
+	s, c := newTestServer(t)
+
+	for _, alert := range []string{"HighCPUUsage", "CriticalCPUUsage"} {
+		rec := serve(s, http.MethodDelete, rulesTestPath+"/"+alert, "", nil)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("delete %s: code = %d: %s", alert, rec.Code, rec.Body)
+		}
+	}
+
+	// The group stays, empty
+	if got := storedRules(t, c, "cpu.rules"); len(got) != 0 {
+		t.Errorf("rules = %v, want none", got)
+	}
+	rec := serve(s, http.MethodGet, rulesTestPath, "", nil)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("list = %d %s, want 200 []", rec.Code, rec.Body)
+	}
+	rec = serve(s, http.MethodDelete, rulesTestPath+"/HighCPUUsage", "", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: code = %d, want 404", rec.Code)
+	}
+}
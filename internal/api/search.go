@@ -0,0 +1,228 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// SearchResult is a rule that matches a search, with the AlertRule and group it is in
+type SearchResult struct {
+	Namespace string                  `json:"namespace"`
+	AlertRule string                  `json:"alertRule"`
+	Group     string                  `json:"group"`
+	Rule      monitoringv1alpha1.Rule `json:"rule"`
+}
+
+// SearchResponse is the response of a rule search
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+// searchQuery is what a rule must match to be found. Every parameter that is set must
+// match.
+type searchQuery struct {
+	// alert is a glob on the alert name. Recording rules never match it.
+	alert string
+	// metric is a glob on the metric names the expr selects
+	metric string
+	// annotation is text, in lower case, that an annotation value must contain
+	annotation string
+	// severities are the allowed values of the severity label
+	severities map[string]bool
+	// matchers are matched against the rule's labels, as PromQL matches series
+	matchers []*labels.Matcher
+}
+
+// parseSearchQuery reads the alert, metric, annotation, severity and label query
+// parameters
+func parseSearchQuery(r *http.Request) (*searchQuery, error) {
+	query := r.URL.Query()
+	q := &searchQuery{
+		alert:      query.Get("alert"),
+		metric:     query.Get("metric"),
+		annotation: strings.ToLower(query.Get("annotation")),
+	}
+
+	if _, err := path.Match(q.alert, ""); err != nil {
+		return nil, fmt.Errorf("invalid alert %q: %w", q.alert, err)
+	}
+	if _, err := path.Match(q.metric, ""); err != nil {
+		return nil, fmt.Errorf("invalid metric %q: %w", q.metric, err)
+	}
+
+	if value := query.Get("severity"); value != "" {
+		q.severities = map[string]bool{}
+		for _, severity := range strings.Split(value, ",") {
+			q.severities[strings.TrimSpace(severity)] = true
+		}
+	}
+
+	for _, value := range query["label"] {
+		matcher, err := parseLabelMatcher(value)
+		if err != nil {
+			return nil, err
+		}
+		q.matchers = append(q.matchers, matcher)
+	}
+	return q, nil
+}
+
+// parseLabelMatcher parses a matcher such as team=network-ops, team!=sre,
+// team=~"net.*" or team!~"net.*". Quoting the value is optional.
+func parseLabelMatcher(value string) (*labels.Matcher, error) {
+	i := strings.IndexAny(value, "=!")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid label %q: expected name=value, name!=value, name=~regex or name!~regex", value)
+	}
+	name, rest := strings.TrimSpace(value[:i]), value[i:]
+
+	var matchType labels.MatchType
+	switch {
+	case strings.HasPrefix(rest, "=~"):
+		matchType, rest = labels.MatchRegexp, rest[2:]
+	case strings.HasPrefix(rest, "!~"):
+		matchType, rest = labels.MatchNotRegexp, rest[2:]
+	case strings.HasPrefix(rest, "!="):
+		matchType, rest = labels.MatchNotEqual, rest[2:]
+	case strings.HasPrefix(rest, "="):
+		matchType, rest = labels.MatchEqual, rest[1:]
+	default:
+		return nil, fmt.Errorf("invalid label %q: expected name=value, name!=value, name=~regex or name!~regex", value)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if unquoted, err := strconv.Unquote(rest); err == nil {
+		rest = unquoted
+	}
+	matcher, err := labels.NewMatcher(matchType, name, rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label %q: %w", value, err)
+	}
+	return matcher, nil
+}
+
+// matches reports whether rule matches every parameter of the search
+func (q *searchQuery) matches(rule *monitoringv1alpha1.Rule) bool {
+	if q.alert != "" {
+		if ok, _ := path.Match(q.alert, rule.Alert); !ok || rule.Alert == "" {
+			return false
+		}
+	}
+	if q.severities != nil && !q.severities[rule.Labels["severity"]] {
+		return false
+	}
+	// A missing label matches as an empty value, as in PromQL
+	for _, matcher := range q.matchers {
+		if !matcher.Matches(rule.Labels[matcher.Name]) {
+			return false
+		}
+	}
+	if q.annotation != "" && !annotationsContain(rule.Annotations, q.annotation) {
+		return false
+	}
+	if q.metric != "" && !selectsMetric(rule.Expr, q.metric) {
+		return false
+	}
+	return true
+}
+
+// annotationsContain reports whether an annotation value contains text, which is in
+// lower case, ignoring case
+func annotationsContain(annotations map[string]string, text string) bool {
+	for _, value := range annotations {
+		if strings.Contains(strings.ToLower(value), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsMetric reports whether expr selects a metric whose name matches the glob
+// pattern. Only selectors with a name, or a __name__ equality matcher, count; a
+// __name__ regex isn't expanded.
+func selectsMetric(expr, pattern string) bool {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	parser.Inspect(parsed, func(node parser.Node, _ []parser.Node) error {
+		selector, ok := node.(*parser.VectorSelector)
+		if !ok || found {
+			return nil
+		}
+		name := selector.Name
+		if name == "" {
+			for _, matcher := range selector.LabelMatchers {
+				if matcher.Name == labels.MetricName && matcher.Type == labels.MatchEqual {
+					name = matcher.Value
+				}
+			}
+		}
+		if ok, _ := path.Match(pattern, name); ok && name != "" {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// searchRules finds rules across AlertRules. The namespace query parameter limits the
+// search to a namespace, and labelSelector and fieldSelector select the AlertRules
+// searched, as for a list.
+func (s *Server) searchRules(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	if !s.authorize(w, r, "list", alertRulesResource, namespace, "") {
+		return
+	}
+
+	ctx := r.Context()
+
+	search, err := parseSearchQuery(r)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
+	}
+	query, err := parseListQuery(r, namespace)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
+	}
+
+	alertRuleList := &monitoringv1alpha1.AlertRuleList{}
+	if err := s.client.List(ctx, alertRuleList, listOptsWithoutPaging(query.opts)...); err != nil {
+		s.logFor(r).Error(err, "Failed to list AlertRules for search")
+		writeError(w, r, err)
+		return
+	}
+	query.filter(alertRuleList)
+
+	response := SearchResponse{Results: []SearchResult{}}
+	for _, alertRule := range alertRuleList.Items {
+		for _, group := range alertRule.Spec.Groups {
+			for _, rule := range group.Rules {
+				if !search.matches(&rule) {
+					continue
+				}
+				response.Results = append(response.Results, SearchResult{
+					Namespace: alertRule.Namespace,
+					AlertRule: alertRule.Name,
+					Group:     group.Name,
+					Rule:      rule,
+				})
+			}
+		}
+	}
+
+	s.writeObject(w, r, http.StatusOK, response)
+}
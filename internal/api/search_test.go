@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// searchResults runs a search with the given query parameters and returns each result
+// as namespace/alertRule/group/rule, sorted
+func searchResults(t *testing.T, s *Server, params url.Values) []string {
+	t.Helper()
+	rec := serve(s, http.MethodGet, "/api/v1/search?"+params.Encode(), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", rec.Code, rec.Body)
+	}
+	response := &SearchResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	results := []string{}
+	for _, result := range response.Results {
+		results = append(results, result.Namespace+"/"+result.AlertRule+"/"+result.Group+"/"+ruleName(&result.Rule))
+	}
+	sort.Strings(results)
+	return results
+}
+
+// ruleName returns the alert or record name of a rule
+func ruleName(rule *monitoringv1alpha1.Rule) string {
+	if rule.Alert != "" {
+		return rule.Alert
+	}
+	return rule.Record
+}
+
+func TestSearch(t *testing.T) {
+	const (
+		highCPU       = "monitoring/cpu-monitoring/cpu.rules/HighCPUUsage"
+		criticalCPU   = "monitoring/cpu-monitoring/cpu.rules/CriticalCPUUsage"
+		responseTime  = "production/app-performance/app.response_time/HighResponseTime"
+		errorRate     = "production/app-performance/app.error_rate/HighErrorRate"
+		lowDOMRXPower = "network/arista-dom-monitoring/kneutral.arista.dom/LowDOMRXPowerCritical"
+	)
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   []string
+	}{
+		{
+			name:   "everything",
+			params: url.Values{},
+			want:   []string{highCPU, criticalCPU, lowDOMRXPower, errorRate, responseTime},
+		},
+		{
+			name:   "alert prefix glob",
+			params: url.Values{"alert": {"High*"}},
+			want:   []string{highCPU, errorRate, responseTime},
+		},
+		{
+			name:   "alert glob in the middle",
+			params: url.Values{"alert": {"*CPU*"}},
+			want:   []string{highCPU, criticalCPU},
+		},
+		{
+			name:   "alert glob with a character class",
+			params: url.Values{"alert": {"[HL]*Critical"}},
+			want:   []string{lowDOMRXPower},
+		},
+		{
+			name:   "severity",
+			params: url.Values{"severity": {"critical"}},
+			want:   []string{criticalCPU, lowDOMRXPower},
+		},
+		{
+			name:   "severity list",
+			params: url.Values{"severity": {"critical, info"}},
+			want:   []string{criticalCPU, lowDOMRXPower},
+		},
+		{
+			name:   "label equality",
+			params: url.Values{"label": {"source=kneutral"}},
+			want:   []string{lowDOMRXPower},
+		},
+		{
+			name:   "label inequality matches a missing label",
+			params: url.Values{"label": {"source!=kneutral"}},
+			want:   []string{highCPU, criticalCPU, errorRate, responseTime},
+		},
+		{
+			name:   "quoted label regex",
+			params: url.Values{"label": {`severity=~"crit.*"`}},
+			want:   []string{criticalCPU, lowDOMRXPower},
+		},
+		{
+			name:   "several label matchers",
+			params: url.Values{"label": {"severity!~warn.*", "source="}},
+			want:   []string{criticalCPU},
+		},
+		{
+			name:   "metric glob",
+			params: url.Values{"metric": {"node_cpu_*"}},
+			want:   []string{highCPU, criticalCPU},
+		},
+		{
+			name:   "metric in a binary expression",
+			params: url.Values{"metric": {"http_requests_total"}},
+			want:   []string{errorRate},
+		},
+		{
+			name:   "metric in a multi-line expression",
+			params: url.Values{"metric": {"arista_smnp_aristaSensorThresholdLowCritical"}},
+			want:   []string{lowDOMRXPower},
+		},
+		{
+			name:   "metric name is not a label value",
+			params: url.Values{"metric": {"DOM RX Power*"}},
+			want:   []string{},
+		},
+		{
+			name:   "annotation text ignores case",
+			params: url.Values{"annotation": {"IMMEDIATE action"}},
+			want:   []string{criticalCPU},
+		},
+		{
+			name:   "annotation text in any annotation",
+			params: url.Values{"annotation": {"grafana.company.com"}},
+			want:   []string{responseTime},
+		},
+		{
+			name:   "every parameter must match",
+			params: url.Values{"metric": {"http_*"}, "severity": {"warning"}, "annotation": {"error rate"}},
+			want:   []string{errorRate},
+		},
+		{
+			name:   "namespace",
+			params: url.Values{"namespace": {"production"}, "alert": {"High*"}},
+			want:   []string{errorRate, responseTime},
+		},
+		{
+			name:   "label selector on the AlertRule",
+			params: url.Values{"labelSelector": {"team=platform"}, "severity": {"critical"}},
+			want:   []string{criticalCPU},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			want := append([]string{}, tt.want...)
+			sort.Strings(want)
+			if got := searchResults(t, s, tt.params); !reflect.DeepEqual(got, want) {
+				t.Errorf("results = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSearchInvalid(t *testing.T) {
+	for _, params := range []url.Values{
+		{"alert": {"High["}},
+		{"metric": {"node_["}},
+		{"label": {"team"}},
+		{"label": {"=platform"}},
+		{"label": {`team=~"("`}},
+	} {
+		s, _ := newTestServer(t)
+		rec := serve(s, http.MethodGet, "/api/v1/search?"+params.Encode(), "", nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400: %s", params.Encode(), rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSelectsMetric(t *testing.T) {
+	tests := []struct {
+		expr    string
+		pattern string
+		want    bool
+	}{
+		{`up == 0`, "up", true},
+		{`up == 0`, "u*", true},
+		{`up == 0`, "down", false},
+		{`{__name__="up", job="node"} == 0`, "up", true},
+		{`{__name__=~"up|down"} == 0`, "up", false},
+		{`{job="node"} == 0`, "*", false},
+		{`sum by (job) (rate(http_requests_total[5m])) / on(job) group_left sum by (job) (rate(http_requests_seconds_count[5m]))`, "http_requests_seconds_*", true},
+		{`absent(up{job="node"})`, "up", true},
+		{`up ==`, "up", false},
+	}
+
+	for _, tt := range tests {
+		if got := selectsMetric(tt.expr, tt.pattern); got != tt.want {
+			t.Errorf("selectsMetric(%q, %q) = %v, want %v", tt.expr, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestSearchAlertSkipsRecordingRules(t *testing.T) {
+	q := &searchQuery{alert: "*"}
+	if q.matches(&monitoringv1alpha1.Rule{Record: "instance:cpu:ratio", Expr: "avg by (instance) (cpu)"}) {
+		t.Error("an alert glob matched a recording rule")
+	}
+	if !q.matches(&monitoringv1alpha1.Rule{Alert: "HighCPU", Expr: "cpu > 90"}) {
+		t.Error("the * alert glob didn't match an alerting rule")
+	}
+}
@@ -4,66 +4,268 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
 )
 
 // Server represents the API server
 type Server struct {
-	client  client.Client
-	address string
-	log     logr.Logger
+	client        client.Client
+	lists         client.Reader
+	events        client.Reader
+	authenticator Authenticator
+	authorizer    Authorizer
+	watchSource   WatchSource
+	watches       *watchHub
+	tls           *TLSOptions
+	corsOrigins   map[string]bool
+	maxBodyBytes  int64
+	timeouts      Timeouts
+	shutdown      chan struct{}
+	address       string
+	log           logr.Logger
 }
 
+// Timeouts bounds how long the server spends on connections and on shutdown
+type Timeouts struct {
+	// Read bounds reading a request, headers and body
+	Read time.Duration
+	// Write bounds handling a request and writing its response
+	Write time.Duration
+	// Idle bounds how long keep-alive connections wait for the next request
+	Idle time.Duration
+	// Shutdown bounds how long in-flight requests may take to finish once the server
+	// is stopped; requests still running afterwards are cancelled
+	Shutdown time.Duration
+}
+
+// DefaultTimeouts are the timeouts of a server created with NewServer
+var DefaultTimeouts = Timeouts{
+	Read:     30 * time.Second,
+	Write:    60 * time.Second,
+	Idle:     120 * time.Second,
+	Shutdown: 20 * time.Second,
+}
+
+// DefaultMaxRequestBodyBytes is the largest request body a server created with
+// NewServer reads
+const DefaultMaxRequestBodyBytes int64 = 8 << 20
+
 // NewServer creates a new API server
 func NewServer(client client.Client, address string) *Server {
 	return &Server{
-		client:  client,
-		address: address,
-		log:     ctrl.Log.WithName("api-server"),
+		client:       client,
+		lists:        client,
+		events:       client,
+		timeouts:     DefaultTimeouts,
+		maxBodyBytes: DefaultMaxRequestBodyBytes,
+		shutdown:     make(chan struct{}),
+		address:      address,
+		log:          ctrl.Log.WithName("api-server"),
+	}
+}
+
+// SetEventReader sets the reader events are listed with. Events are selected by
+// involved object, which the manager's cache can't do, so the operator passes the
+// uncached API reader.
+func (s *Server) SetEventReader(reader client.Reader) {
+	s.events = reader
+}
+
+// SetListReader sets the reader AlertRules are listed with. Paginated lists need
+// continue tokens, which the manager's cache can't provide, so the operator passes the
+// uncached API reader.
+func (s *Server) SetListReader(reader client.Reader) {
+	s.lists = reader
+}
+
+// SetAuthenticator requires callers of the /api endpoints to be identified by a.
+// Without one the API is served unauthenticated, as in standalone mode.
+func (s *Server) SetAuthenticator(a Authenticator) {
+	s.authenticator = a
+}
+
+// SetTimeouts replaces DefaultTimeouts. Zero values mean no timeout.
+func (s *Server) SetTimeouts(t Timeouts) {
+	s.timeouts = t
+}
+
+// SetMaxRequestBodyBytes replaces DefaultMaxRequestBodyBytes. Larger bodies are
+// rejected with 413 Request Entity Too Large; zero means no limit.
+func (s *Server) SetMaxRequestBodyBytes(n int64) {
+	s.maxBodyBytes = n
+}
+
+// SetCORSOrigins lets browsers on the given origins call the API. "*" allows any
+// origin. Without origins no CORS headers are sent and browsers keep cross-origin
+// requests from reading responses.
+func (s *Server) SetCORSOrigins(origins []string) {
+	s.corsOrigins = nil
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if s.corsOrigins == nil {
+			s.corsOrigins = make(map[string]bool)
+		}
+		s.corsOrigins[origin] = true
 	}
 }
 
-// Start starts the API server
-func (s *Server) Start() error {
+// handler returns the routes of the API wrapped in the middleware chain
+func (s *Server) handler() http.Handler {
 	mux := http.NewServeMux()
 
+	// handle registers a handler whose requests are counted under route
+	handle := func(pattern, route string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			setRoute(r, route)
+			handler(w, r)
+		})
+	}
+
 	// Health endpoint
-	mux.HandleFunc("/health", s.handleHealth)
+	handle("/health", "/health", s.handleHealth)
 
 	// AlertRule CRUD endpoints
-	mux.HandleFunc("/api/v1/alertrules", s.handleAlertRules)
+	handle("/api/v1/alertrules", "/api/v1/alertrules", s.handleAlertRules)
+	handle("/api/v1/alertrules:export", "/api/v1/alertrules:export", s.handleAlertRulesExport)
+	handle("/api/v1/alertrules:batch", "/api/v1/alertrules:batch", s.handleAlertRulesBatch)
+	// Namespaced requests set their route once the path is parsed
 	mux.HandleFunc("/api/v1/namespaces/", s.handleNamespacedAlertRules)
 
+	// Rule search across AlertRules
+	handle("/api/v1/search", "/api/v1/search", s.handleSearch)
+
 	// Serve OpenAPI spec
-	mux.HandleFunc("/openapi/v2", s.handleOpenAPISpec)
+	handle("/openapi/v2", "/openapi/v2", s.handleOpenAPISpec)
 
 	// Serve documentation (for standalone mode)
-	mux.HandleFunc("/docs", s.handleDocs)
-	mux.HandleFunc("/docs/", s.handleDocs)
+	handle("/docs", "/docs", s.handleDocs)
+	handle("/docs/", "/docs", s.handleDocs)
 
-	s.log.Info("API server listening", "address", s.address)
-	return http.ListenAndServe(s.address, s.corsMiddleware(mux))
+	return s.metricsMiddleware(s.requestIDMiddleware(s.corsMiddleware(s.authMiddleware(s.bodyLimitMiddleware(mux)))))
 }
 
-// corsMiddleware adds CORS headers
+// Start serves the API until ctx is done, then stops accepting connections and waits
+// for in-flight requests to finish. It implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	// Request contexts derive from requestCtx rather than ctx, so a shutdown lets
+	// in-flight requests finish instead of cancelling them straight away
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	server := &http.Server{
+		Addr:              s.address,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: s.timeouts.Read,
+		ReadTimeout:       s.timeouts.Read,
+		WriteTimeout:      s.timeouts.Write,
+		IdleTimeout:       s.timeouts.Idle,
+		BaseContext:       func(net.Listener) context.Context { return requestCtx },
+	}
+	// Watches would hold up Shutdown until the timeout, so they are ended as it starts
+	server.RegisterOnShutdown(func() { close(s.shutdown) })
+
+	if s.watchSource != nil {
+		hub := newWatchHub()
+		if _, err := s.watchSource.AddEventHandler(hub); err != nil {
+			return fmt.Errorf("failed to watch AlertRules: %w", err)
+		}
+		s.watches = hub
+	}
+
+	if s.tls != nil {
+		tlsConfig, err := s.tlsConfig(ctx)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.tls == nil {
+			s.log.Info("API server listening", "address", s.address)
+			serveErr <- server.ListenAndServe()
+			return
+		}
+		s.log.Info("API server listening with TLS", "address", s.address, "clientCA", s.tls.ClientCAFile != "")
+		// The certificate comes from TLSConfig, so no files are passed here
+		serveErr <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.log.Info("Shutting down API server, waiting for in-flight requests")
+	shutdownCtx := context.Background()
+	if s.timeouts.Shutdown > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.timeouts.Shutdown)
+		defer cancel()
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.log.Info("In-flight requests did not finish in time, cancelling them", "timeout", s.timeouts.Shutdown)
+		cancelRequests()
+		return server.Close()
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica serves
+// the API, not just the leader.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// corsMiddleware adds CORS headers for the allowed origins and answers their
+// preflight requests, which carry no credentials, before authentication
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	if len(s.corsOrigins) == 0 {
+		return next
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!s.corsOrigins[origin] && !s.corsOrigins["*"]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-Match, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
@@ -71,6 +273,91 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// bodyLimitMiddleware stops reading request bodies past the configured limit
+func (s *Server) bodyLimitMiddleware(next http.Handler) http.Handler {
+	if s.maxBodyBytes <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authMiddleware rejects requests to the /api endpoints whose caller can't be
+// authenticated, before any handler uses the operator's own credentials. Health,
+// docs and the OpenAPI spec stay public.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	if s.authenticator == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, ok, err := s.authenticator.Authenticate(r.Context(), r)
+		if err != nil {
+			s.logFor(r).Error(err, "Failed to authenticate request", "path", r.URL.Path)
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kneutral-operator"`)
+			writeError(w, r, errors.NewUnauthorized("Unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which watches need
+// to flush events and clear the write deadline
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// routeKey is the context key of the route a request is counted under
+type routeKey struct{}
+
+// setRoute records the route pattern that matched a request, so that namespaces and
+// names don't end up in metric labels
+func setRoute(r *http.Request, pattern string) {
+	if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*route = pattern
+	}
+}
+
+// metricsMiddleware records the count and latency of each request by route. Requests
+// that match no route, or are rejected before they reach one, are counted as other.
+func (s *Server) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		route := "other"
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+
+		code := strconv.Itoa(recorder.status)
+		metrics.APIRequestsTotal.WithLabelValues(route, r.Method, code).Inc()
+		metrics.APIRequestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
 // handleHealth handles health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -82,105 +369,211 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAlertRules(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
+		if isWatch(r) {
+			s.watchAlertRules(w, r, "")
+			return
+		}
 		s.listAlertRules(w, r, "")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
 	}
 }
 
+// handleAlertRulesExport handles the export of AlertRules across all namespaces
+func (s *Server) handleAlertRulesExport(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.exportAlertRules(w, r, "")
+	default:
+		writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+	}
+}
+
+// handleSearch handles rule searches across AlertRules
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.searchRules(w, r)
+	default:
+		writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+	}
+}
+
+// handleAlertRulesBatch handles batches of AlertRule operations across namespaces
+func (s *Server) handleAlertRulesBatch(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.batchAlertRules(w, r)
+	default:
+		writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+	}
+}
+
+// invalidPathMessage is the error for paths under /api/v1/namespaces/ that name no resource
+const invalidPathMessage = "Invalid URL format, expected /api/v1/namespaces/{namespace}/alertrules[:import|:export|/{name}[/events|/preview|/export|/groups/{group}/rules[/{alert}]]]"
+
 // handleNamespacedAlertRules handles namespaced AlertRule operations
 func (s *Server) handleNamespacedAlertRules(w http.ResponseWriter, r *http.Request) {
 	// Parse namespace and name from URL
 	// Expected format: /api/v1/namespaces/{namespace}/alertrules/{name}
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
 	if len(parts) < 2 {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		writeError(w, r, errors.NewBadRequest(invalidPathMessage))
 		return
 	}
 
 	namespace := parts[0]
 
 	// Check if this is a collection operation or a specific resource
-	if len(parts) == 2 && parts[1] == "alertrules" {
+	if len(parts) == 2 && parts[1] == "alertrules:import" {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules:import")
+		switch r.Method {
+		case http.MethodPost:
+			s.importAlertRule(w, r, namespace)
+		default:
+			writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+		}
+	} else if len(parts) == 2 && parts[1] == "alertrules:export" {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules:export")
+		switch r.Method {
+		case http.MethodGet:
+			s.exportAlertRules(w, r, namespace)
+		default:
+			writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+		}
+	} else if len(parts) == 2 && parts[1] == "alertrules" {
 		// Collection operations
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules")
 		switch r.Method {
 		case http.MethodGet:
+			if isWatch(r) {
+				s.watchAlertRules(w, r, namespace)
+				return
+			}
 			s.listAlertRules(w, r, namespace)
 		case http.MethodPost:
 			s.createAlertRule(w, r, namespace)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
 		}
 	} else if len(parts) == 3 && parts[1] == "alertrules" {
 		// Specific resource operations
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules/{name}")
 		name := parts[2]
 		switch r.Method {
 		case http.MethodGet:
 			s.getAlertRule(w, r, namespace, name)
 		case http.MethodPut:
 			s.updateAlertRule(w, r, namespace, name)
+		case http.MethodPatch:
+			s.patchAlertRule(w, r, namespace, name)
 		case http.MethodDelete:
 			s.deleteAlertRule(w, r, namespace, name)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
 		}
+	} else if len(parts) == 4 && parts[1] == "alertrules" && parts[3] == "preview" {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules/{name}/preview")
+		switch r.Method {
+		case http.MethodPost:
+			s.previewAlertRule(w, r, namespace, parts[2])
+		default:
+			writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+		}
+	} else if len(parts) == 4 && parts[1] == "alertrules" && parts[3] == "export" {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules/{name}/export")
+		switch r.Method {
+		case http.MethodGet:
+			s.exportAlertRule(w, r, namespace, parts[2])
+		default:
+			writeError(w, r, errors.NewMethodNotSupported(alertRulesResource, r.Method))
+		}
+	} else if len(parts) == 4 && parts[1] == "alertrules" && parts[3] == "events" {
+		setRoute(r, "/api/v1/namespaces/{namespace}/alertrules/{name}/events")
+		switch r.Method {
+		case http.MethodGet:
+			s.listAlertRuleEvents(w, r, namespace, parts[2])
+		default:
+			writeError(w, r, errors.NewMethodNotSupported(eventsResource, r.Method))
+		}
+	} else if len(parts) >= 6 && parts[1] == "alertrules" && parts[3] == "groups" {
+		// Group names may contain an escaped slash, so handleRules splits the path again
+		s.handleRules(w, r, namespace, parts[2])
 	} else {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		writeError(w, r, errors.NewBadRequest(invalidPathMessage))
 	}
 }
 
 // listAlertRules lists all AlertRules
 func (s *Server) listAlertRules(w http.ResponseWriter, r *http.Request, namespace string) {
-	ctx := context.Background()
+	if !s.authorize(w, r, "list", alertRulesResource, namespace, "") {
+		return
+	}
+
+	ctx := r.Context()
 	alertRuleList := &monitoringv1alpha1.AlertRuleList{}
 
-	opts := []client.ListOption{}
-	if namespace != "" {
-		opts = append(opts, client.InNamespace(namespace))
+	query, err := parseListQuery(r, namespace)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
 	}
 
-	if err := s.client.List(ctx, alertRuleList, opts...); err != nil {
-		s.log.Error(err, "Failed to list AlertRules")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// An expired continue token comes back as a 410 with the API server's explanation
+	if err := s.lists.List(ctx, alertRuleList, query.opts...); err != nil {
+		if !errors.IsResourceExpired(err) && !errors.IsBadRequest(err) {
+			s.logFor(r).Error(err, "Failed to list AlertRules")
+		}
+		writeError(w, r, err)
 		return
 	}
+	query.filter(alertRuleList)
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(alertRuleList); err != nil {
-		s.log.Error(err, "Failed to encode response")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	s.writeObject(w, r, http.StatusOK, alertRuleList)
 }
 
 // getAlertRule gets a specific AlertRule
 func (s *Server) getAlertRule(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	ctx := context.Background()
+	if !s.authorize(w, r, "get", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
 	alertRule := &monitoringv1alpha1.AlertRule{}
 
 	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, alertRule); err != nil {
-		if errors.IsNotFound(err) {
-			http.Error(w, "AlertRule not found", http.StatusNotFound)
-			return
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
 		}
-		s.log.Error(err, "Failed to get AlertRule")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(alertRule); err != nil {
-		s.log.Error(err, "Failed to encode response")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	setETag(w, alertRule.ResourceVersion)
+	s.writeObject(w, r, http.StatusOK, alertRule)
 }
 
 // createAlertRule creates a new AlertRule
 func (s *Server) createAlertRule(w http.ResponseWriter, r *http.Request, namespace string) {
-	ctx := context.Background()
+	if !s.authorize(w, r, "create", alertRulesResource, namespace, "") {
+		return
+	}
+
+	ctx := r.Context()
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var opts []client.CreateOption
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
 
 	var alertRule monitoringv1alpha1.AlertRule
-	if err := json.NewDecoder(r.Body).Decode(&alertRule); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if err := decodeBody(r, &alertRule); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -197,74 +590,245 @@ func (s *Server) createAlertRule(w http.ResponseWriter, r *http.Request, namespa
 
 	// Validate required fields
 	if alertRule.Name == "" {
-		http.Error(w, "AlertRule name is required", http.StatusBadRequest)
+		writeError(w, r, newInvalid("", field.ErrorList{field.Required(field.NewPath("metadata", "name"), "")}))
 		return
 	}
 
-	if len(alertRule.Spec.Groups) == 0 {
-		http.Error(w, "At least one alert group is required", http.StatusBadRequest)
+	// Apply the same defaults as the admission webhook so both paths store identical objects
+	validation.SetDefaults(&alertRule.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&alertRule.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&alertRule.Spec), metrics.SourceAPI).Inc()
+		writeError(w, r, newInvalid(alertRule.Name, errs))
 		return
 	}
 
-	if err := s.client.Create(ctx, &alertRule); err != nil {
-		if errors.IsAlreadyExists(err) {
-			http.Error(w, "AlertRule already exists", http.StatusConflict)
-			return
+	if err := s.client.Create(ctx, &alertRule, opts...); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			s.logFor(r).Error(err, "Failed to create AlertRule")
 		}
-		s.log.Error(err, "Failed to create AlertRule")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(&alertRule); err != nil {
-		s.log.Error(err, "Failed to encode response")
-	}
+	setETag(w, alertRule.ResourceVersion)
+	s.writeObject(w, r, http.StatusCreated, &alertRule)
 }
 
 // updateAlertRule updates an existing AlertRule
 func (s *Server) updateAlertRule(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	ctx := context.Background()
+	if !s.authorize(w, r, "update", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var opts []client.UpdateOption
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
 
 	// Get existing AlertRule
 	existing := &monitoringv1alpha1.AlertRule{}
 	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, existing); err != nil {
-		if errors.IsNotFound(err) {
-			http.Error(w, "AlertRule not found", http.StatusNotFound)
-			return
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
 		}
-		s.log.Error(err, "Failed to get AlertRule")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	if !checkIfMatch(w, r, existing.ResourceVersion) {
 		return
 	}
 
-	// Decode update from request body
+	// Decode update from request body, which may be JSON or YAML
 	var update monitoringv1alpha1.AlertRule
-	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if err := decodeBody(r, &update); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	validation.SetDefaults(&update.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&update.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&update.Spec), metrics.SourceAPI).Inc()
+		writeError(w, r, newInvalid(name, errs))
 		return
 	}
 
 	// Update the spec
 	existing.Spec = update.Spec
 
-	if err := s.client.Update(ctx, existing); err != nil {
-		s.log.Error(err, "Failed to update AlertRule")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// A resourceVersion in the body makes the update conditional on it, as with
+	// kubectl replace. Without one the version just read still guards against a
+	// concurrent write between the Get and the Update.
+	if update.ResourceVersion != "" {
+		existing.ResourceVersion = update.ResourceVersion
+	}
+
+	if err := s.client.Update(ctx, existing, opts...); err != nil {
+		if !errors.IsConflict(err) && !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to update AlertRule")
+		}
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(existing); err != nil {
-		s.log.Error(err, "Failed to encode response")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	setETag(w, existing.ResourceVersion)
+	s.writeObject(w, r, http.StatusOK, existing)
+}
+
+// patchContentTypes maps the media types PATCH accepts onto their patch types
+var patchContentTypes = map[string]types.PatchType{
+	string(types.MergePatchType):          types.MergePatchType,
+	string(types.JSONPatchType):           types.JSONPatchType,
+	string(types.StrategicMergePatchType): types.StrategicMergePatchType,
+}
+
+// patchAlertRule applies a JSON merge patch, JSON patch or strategic merge patch to an
+// AlertRule. The patch is applied here so the result can be validated, and the change
+// is then sent as a merge patch guarded by the resourceVersion it was computed from.
+// This also makes strategic merge patches work, which the API server refuses for
+// custom resources.
+func (s *Server) patchAlertRule(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if !s.authorize(w, r, "patch", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var opts []client.PatchOption
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	patchType, ok := patchContentTypes[mediaType]
+	if !ok {
+		writeError(w, r, newStatusError(http.StatusUnsupportedMediaType, metav1.StatusReasonUnsupportedMediaType,
+			fmt.Sprintf("Unsupported patch content type %q, use %s, %s or %s",
+				mediaType, types.MergePatchType, types.JSONPatchType, types.StrategicMergePatchType)))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, bodyError(err))
+		return
+	}
+
+	existing := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, existing); err != nil {
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	if !checkIfMatch(w, r, existing.ResourceVersion) {
+		return
+	}
+
+	patched, err := applyPatch(existing, patchType, body)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(fmt.Sprintf("Invalid patch: %v", err)))
+		return
+	}
+	// A patch may carry the resourceVersion it was written against, as kubectl's do
+	if patched.ResourceVersion != existing.ResourceVersion {
+		writeError(w, r, errors.NewConflict(alertRulesResource, name,
+			fmt.Errorf("the patch is based on resourceVersion %s, but the AlertRule is at %s", patched.ResourceVersion, existing.ResourceVersion)))
+		return
+	}
+	var immutable field.ErrorList
+	if patched.Name != name {
+		immutable = append(immutable, field.Forbidden(field.NewPath("metadata", "name"), "can't be patched"))
+	}
+	if patched.Namespace != namespace {
+		immutable = append(immutable, field.Forbidden(field.NewPath("metadata", "namespace"), "can't be patched"))
+	}
+	if len(immutable) > 0 {
+		writeError(w, r, newInvalid(name, immutable))
+		return
+	}
+
+	validation.SetDefaults(&patched.Spec)
+
+	if errs := validation.ValidateAlertRuleSpec(&patched.Spec); len(errs) > 0 {
+		metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&patched.Spec), metrics.SourceAPI).Inc()
+		writeError(w, r, newInvalid(name, errs))
+		return
 	}
+
+	// Only labels, annotations and the spec are patchable, the rest of the object is kept
+	updated := existing.DeepCopy()
+	updated.Labels = patched.Labels
+	updated.Annotations = patched.Annotations
+	updated.Spec = patched.Spec
+
+	if err := s.client.Patch(ctx, updated, client.MergeFromWithOptions(existing, client.MergeFromWithOptimisticLock{}), opts...); err != nil {
+		if !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			s.logFor(r).Error(err, "Failed to patch AlertRule")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, updated.ResourceVersion)
+	s.writeObject(w, r, http.StatusOK, updated)
+}
+
+// applyPatch returns a copy of alertRule with the patch applied
+func applyPatch(alertRule *monitoringv1alpha1.AlertRule, patchType types.PatchType, patch []byte) (*monitoringv1alpha1.AlertRule, error) {
+	original, err := json.Marshal(alertRule)
+	if err != nil {
+		return nil, err
+	}
+
+	var patchedJSON []byte
+	switch patchType {
+	case types.MergePatchType:
+		patchedJSON, err = jsonpatch.MergePatch(original, patch)
+	case types.JSONPatchType:
+		var decoded jsonpatch.Patch
+		if decoded, err = jsonpatch.DecodePatch(patch); err == nil {
+			patchedJSON, err = decoded.Apply(original)
+		}
+	case types.StrategicMergePatchType:
+		patchedJSON, err = strategicpatch.StrategicMergePatch(original, patch, &monitoringv1alpha1.AlertRule{})
+	default:
+		err = fmt.Errorf("unsupported patch type %q", patchType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	patched := &monitoringv1alpha1.AlertRule{}
+	if err := json.Unmarshal(patchedJSON, patched); err != nil {
+		return nil, err
+	}
+	return patched, nil
 }
 
 // deleteAlertRule deletes an AlertRule
 func (s *Server) deleteAlertRule(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	ctx := context.Background()
+	if !s.authorize(w, r, "delete", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
 
 	alertRule := &monitoringv1alpha1.AlertRule{
 		ObjectMeta: metav1.ObjectMeta{
@@ -273,27 +837,89 @@ func (s *Server) deleteAlertRule(w http.ResponseWriter, r *http.Request, namespa
 		},
 	}
 
-	if err := s.client.Delete(ctx, alertRule); err != nil {
-		if errors.IsNotFound(err) {
-			http.Error(w, "AlertRule not found", http.StatusNotFound)
+	var opts []client.DeleteOption
+	if _, wildcard, present := ifMatch(r); present && !wildcard {
+		// Compare with the current version for a 412, then make the delete itself
+		// conditional in case it changes in between
+		if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, alertRule); err != nil {
+			if !errors.IsNotFound(err) {
+				s.logFor(r).Error(err, "Failed to get AlertRule")
+			}
+			writeError(w, r, err)
+			return
+		}
+		if !checkIfMatch(w, r, alertRule.ResourceVersion) {
 			return
 		}
-		s.log.Error(err, "Failed to delete AlertRule")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		opts = append(opts, client.Preconditions{ResourceVersion: &alertRule.ResourceVersion})
+	}
+
+	if err := s.client.Delete(ctx, alertRule, opts...); err != nil {
+		if !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			s.logFor(r).Error(err, "Failed to delete AlertRule")
+		}
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// listAlertRuleEvents lists the events recorded for an AlertRule, oldest first
+func (s *Server) listAlertRuleEvents(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	// The AlertRule is read to match its events, which needs get on it too
+	if !s.authorize(w, r, "list", eventsResource, namespace, "") ||
+		!s.authorize(w, r, "get", alertRulesResource, namespace, name) {
+		return
+	}
+
+	ctx := r.Context()
+
+	// Events outlive their object, so match on the UID to skip those of a deleted
+	// AlertRule with the same name
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, alertRule); err != nil {
+		if !errors.IsNotFound(err) {
+			s.logFor(r).Error(err, "Failed to get AlertRule")
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	eventList := &corev1.EventList{}
+	if err := s.events.List(ctx, eventList, client.InNamespace(namespace), client.MatchingFields{
+		"involvedObject.kind": "AlertRule",
+		"involvedObject.name": name,
+		"involvedObject.uid":  string(alertRule.UID),
+	}); err != nil {
+		s.logFor(r).Error(err, "Failed to list events")
+		writeError(w, r, err)
+		return
+	}
+
+	sort.SliceStable(eventList.Items, func(i, j int) bool {
+		return eventTime(&eventList.Items[i]).Before(eventTime(&eventList.Items[j]))
+	})
+
+	s.writeObject(w, r, http.StatusOK, eventList)
+}
+
+// eventTime returns when an event last occurred
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
 // handleOpenAPISpec serves the OpenAPI specification
 func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 	spec := getOpenAPISpec()
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(spec); err != nil {
-		s.log.Error(err, "Failed to encode OpenAPI spec")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	s.writeObject(w, r, http.StatusOK, spec)
 }
 
 // handleDocs serves basic API documentation
@@ -362,11 +988,26 @@ func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
         <small>List AlertRules in a specific namespace</small>
     </div>
 
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/alertrules?watch=true<br>
+        <small>Stream AlertRule changes as JSON lines or Server-Sent Events (also per namespace)</small>
+    </div>
+
     <div class="endpoint">
         <span class="method">POST</span> /api/v1/namespaces/{namespace}/alertrules<br>
         <small>Create a new AlertRule</small>
     </div>
 
+    <div class="endpoint">
+        <span class="method">POST</span> /api/v1/namespaces/{namespace}/alertrules:import<br>
+        <small>Create an AlertRule from a Prometheus rules file or PrometheusRule manifest (JSON or YAML)</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">POST</span> /api/v1/alertrules:batch<br>
+        <small>Create, upsert and delete AlertRules across namespaces in one call, optionally all-or-nothing</small>
+    </div>
+
     <div class="endpoint">
         <span class="method">GET</span> /api/v1/namespaces/{namespace}/alertrules/{name}<br>
         <small>Get a specific AlertRule</small>
@@ -377,11 +1018,71 @@ func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
         <small>Update an existing AlertRule</small>
     </div>
 
+    <div class="endpoint">
+        <span class="method">PATCH</span> /api/v1/namespaces/{namespace}/alertrules/{name}<br>
+        <small>Patch an AlertRule (merge, JSON or strategic merge patch)</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">POST</span> /api/v1/namespaces/{namespace}/alertrules/{name}/preview<br>
+        <small>Render the PrometheusRule for a proposed AlertRule and diff it against the live one</small>
+    </div>
+
     <div class="endpoint">
         <span class="method">DELETE</span> /api/v1/namespaces/{namespace}/alertrules/{name}<br>
         <small>Delete an AlertRule</small>
     </div>
 
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/namespaces/{namespace}/alertrules/{name}/events<br>
+        <small>List the Kubernetes Events recorded for an AlertRule</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/namespaces/{namespace}/alertrules/{name}/export?format=prometheus<br>
+        <small>Export an AlertRule as a plain Prometheus rule file</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/alertrules:export?labelSelector=...<br>
+        <small>Export matching AlertRules as one rule file, or with archive=tar a file per AlertRule (also per namespace)</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules<br>
+        <small>List the rules of a group, alerting and recording</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">POST</span> /api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules<br>
+        <small>Add a rule to a group</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}<br>
+        <small>Get an alerting rule by group and alert name</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">POST</span> /api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}<br>
+        <small>Add an alerting rule with the given alert name</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">PUT</span> /api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}<br>
+        <small>Replace an alerting rule</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">DELETE</span> /api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}<br>
+        <small>Remove an alerting rule from its group</small>
+    </div>
+
+    <div class="endpoint">
+        <span class="method">GET</span> /api/v1/search?metric=...&amp;severity=...&amp;label=...<br>
+        <small>Find rules across AlertRules by alert name, referenced metric, labels, annotation text or severity</small>
+    </div>
+
     <h2>OpenAPI Specification</h2>
     <p><a href="/openapi/v2">View OpenAPI JSON</a></p>
 
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/mock"
+)
+
+// newTestServer returns an unauthenticated server backed by a MockClient holding the
+// example AlertRules
+func newTestServer(t *testing.T) (*Server, *mock.MockClient) {
+	t.Helper()
+	c := mock.NewMockClient()
+	mock.PopulateExampleData(c)
+	s := NewServer(c, "")
+	s.SetWatchSource(c)
+	return s, c
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name       string
+		origins    []string
+		method     string
+		origin     string
+		wantCode   int
+		wantOrigin string
+	}{
+		{name: "no origins configured", method: http.MethodGet, origin: "https://evil.example.com", wantCode: http.StatusOK},
+		{name: "no origins configured preflight", method: http.MethodOptions, origin: "https://evil.example.com", wantCode: http.StatusMethodNotAllowed},
+		{name: "allowed origin", origins: []string{"https://dashboard.example.com"}, method: http.MethodGet, origin: "https://dashboard.example.com", wantCode: http.StatusOK, wantOrigin: "https://dashboard.example.com"},
+		{name: "allowed origin preflight", origins: []string{" https://dashboard.example.com", ""}, method: http.MethodOptions, origin: "https://dashboard.example.com", wantCode: http.StatusNoContent, wantOrigin: "https://dashboard.example.com"},
+		{name: "other origin", origins: []string{"https://dashboard.example.com"}, method: http.MethodGet, origin: "https://evil.example.com", wantCode: http.StatusOK},
+		{name: "other origin preflight", origins: []string{"https://dashboard.example.com"}, method: http.MethodOptions, origin: "https://evil.example.com", wantCode: http.StatusMethodNotAllowed},
+		{name: "any origin", origins: []string{"*"}, method: http.MethodGet, origin: "https://evil.example.com", wantCode: http.StatusOK, wantOrigin: "https://evil.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.SetCORSOrigins(tt.origins)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/alertrules", nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+			}
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin != "" && rec.Header().Get("Access-Control-Allow-Methods") == "" {
+				t.Error("Access-Control-Allow-Methods not set for an allowed origin")
+			}
+		})
+	}
+}
+
+func TestMaxRequestBodyBytes(t *testing.T) {
+	body := `{"apiVersion":"monitoring.kneutral.io/v1alpha1","kind":"AlertRule","metadata":{"name":"big"},` +
+		`"spec":{"groups":[{"name":"g","rules":[{"alert":"A","expr":"up == 0"}]}]}}`
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		ctype    string
+		limit    int64
+		wantCode int
+	}{
+		{name: "create over the limit", method: http.MethodPost, path: "/api/v1/namespaces/monitoring/alertrules", limit: 64, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "patch over the limit", method: http.MethodPatch, path: "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring", ctype: "application/merge-patch+json", limit: 64, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "create within the limit", method: http.MethodPost, path: "/api/v1/namespaces/monitoring/alertrules", limit: DefaultMaxRequestBodyBytes, wantCode: http.StatusCreated},
+		{name: "no limit", method: http.MethodPost, path: "/api/v1/namespaces/monitoring/alertrules", wantCode: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.SetMaxRequestBodyBytes(tt.limit)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			if tt.ctype != "" {
+				req.Header.Set("Content-Type", tt.ctype)
+			}
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode == http.StatusRequestEntityTooLarge {
+				status := decodeStatus(t, rec)
+				if status.Reason != metav1.StatusReasonRequestEntityTooLarge {
+					t.Errorf("reason = %q, want %q", status.Reason, metav1.StatusReasonRequestEntityTooLarge)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteMetrics(t *testing.T) {
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantRoute string
+	}{
+		{path: "/health", wantCode: http.StatusOK, wantRoute: "/health"},
+		{path: "/docs/index.html", wantCode: http.StatusOK, wantRoute: "/docs"},
+		{path: "/api/v1/alertrules", wantCode: http.StatusOK, wantRoute: "/api/v1/alertrules"},
+		{path: "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring", wantCode: http.StatusOK, wantRoute: "/api/v1/namespaces/{namespace}/alertrules/{name}"},
+		{path: "/api/v1/namespaces/monitoring/alertrules/missing", wantCode: http.StatusNotFound, wantRoute: "/api/v1/namespaces/{namespace}/alertrules/{name}"},
+		{path: "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/groups/cpu.rules/rules", wantCode: http.StatusOK, wantRoute: "/api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules"},
+		{path: "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/groups/cpu%2Frules/rules", wantCode: http.StatusNotFound, wantRoute: "/api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules"},
+		{path: "/api/v1/namespaces/monitoring/alertrules/cpu-monitoring/groups/cpu%2Frules/rules/HighCPU", wantCode: http.StatusNotFound, wantRoute: "/api/v1/namespaces/{namespace}/alertrules/{name}/groups/{group}/rules/{alert}"},
+		{path: "/api/v1/namespaces/monitoring/widgets", wantCode: http.StatusBadRequest, wantRoute: "other"},
+		{path: "/unknown", wantCode: http.StatusNotFound, wantRoute: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			counter := metrics.APIRequestsTotal.WithLabelValues(tt.wantRoute, http.MethodGet, strconv.Itoa(tt.wantCode))
+			before := testutil.ToFloat64(counter)
+
+			rec := serve(s, http.MethodGet, tt.path, "", nil)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if after := testutil.ToFloat64(counter); after != before+1 {
+				t.Errorf("requests counted under route %q went from %v to %v, want one more", tt.wantRoute, before, after)
+			}
+		})
+	}
+}
+
+// decodeStatus decodes the Status body of an error response
+func decodeStatus(t *testing.T, rec *httptest.ResponseRecorder) *metav1.Status {
+	t.Helper()
+	status := &metav1.Status{}
+	if err := json.Unmarshal(rec.Body.Bytes(), status); err != nil {
+		t.Fatalf("response is not a Status: %v: %s", err, rec.Body)
+	}
+	return status
+}
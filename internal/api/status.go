@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// requestIDHeader carries the ID of a request. A caller's own ID is kept, otherwise
+// one is generated; either way it is returned in the response.
+const requestIDHeader = "X-Request-ID"
+
+// Kubernetes has no reasons for these responses, since its API has no precondition
+// headers and serves every endpoint it documents
+const (
+	reasonPreconditionFailed metav1.StatusReason = "PreconditionFailed"
+	reasonNotImplemented     metav1.StatusReason = "NotImplemented"
+)
+
+// alertRuleKind is the kind validation errors are reported for
+var alertRuleKind = monitoringv1alpha1.GroupVersion.WithKind("AlertRule").GroupKind()
+
+// Status is the body of every error response: a Kubernetes Status, which kubectl and
+// client-go understand, with the ID of the request it answers
+type Status struct {
+	metav1.Status `json:",inline"`
+
+	// RequestID is the X-Request-ID of the request, to find it in the operator's logs
+	RequestID string `json:"requestID,omitempty"`
+}
+
+type requestIDKey struct{}
+
+// requestIDFrom returns the ID of the request ctx belongs to
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware gives every request an ID, returned in the X-Request-ID header and
+// in error responses
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = string(uuid.NewUUID())
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// logFor returns the server's logger with the ID of request r, so errors reported to a
+// caller can be found in the logs
+func (s *Server) logFor(r *http.Request) logr.Logger {
+	return s.log.WithValues("requestID", requestIDFrom(r.Context()))
+}
+
+// newStatusError returns an error for the responses apierrors has no constructor for
+func newStatusError(code int32, reason metav1.StatusReason, message string) *apierrors.StatusError {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  reason,
+		Message: message,
+	}}
+}
+
+// bodyError returns the error for a request body that couldn't be read: 413 when it
+// is over the server's limit, 400 otherwise
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apierrors.NewRequestEntityTooLargeError(fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+	}
+	return apierrors.NewBadRequest(fmt.Sprintf("Invalid request body: %v", err))
+}
+
+// newInvalid returns the error for an AlertRule that fails validation, with a cause per
+// invalid field. Its reason is Invalid as with the Kubernetes API, but the code is 400,
+// which API clients have relied on since expressions were first validated.
+func newInvalid(name string, errs field.ErrorList) *apierrors.StatusError {
+	err := apierrors.NewInvalid(alertRuleKind, name, errs)
+	err.ErrStatus.Code = http.StatusBadRequest
+	return err
+}
+
+// writeError writes err as a Status response
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	writeStatus(w, r, apiStatus(err))
+}
+
+// apiStatus returns the Status reported for err. Errors from the Kubernetes API keep
+// their Status; any other error is an internal error.
+func apiStatus(err error) metav1.Status {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Status != metav1.StatusFailure {
+		status = apierrors.NewInternalError(err)
+	}
+	result := status.Status()
+	// Objects the Kubernetes API rejects as invalid get the same code as those rejected
+	// by newInvalid
+	if result.Reason == metav1.StatusReasonInvalid {
+		result.Code = http.StatusBadRequest
+	}
+	return result
+}
+
+// writeStatus writes a Kubernetes Status object with its code as the HTTP status, as
+// YAML if the request accepts it and as JSON otherwise
+func writeStatus(w http.ResponseWriter, r *http.Request, status metav1.Status) {
+	status.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+	if status.Code == 0 {
+		status.Code = http.StatusInternalServerError
+	}
+	data, mediaType, err := encodeBody(r, Status{Status: status, RequestID: requestIDFrom(r.Context())})
+	if err != nil {
+		http.Error(w, status.Message, int(status.Code))
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(int(status.Code))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestInvalidAlertRule(t *testing.T) {
+	body := `{"metadata":{"name":"broken"},"spec":{"groups":[{"name":"cpu.rules","rules":[{"alert":"HighCPU","expr":"cpu >"}]}]}}`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "create", method: http.MethodPost, path: "/api/v1/namespaces/monitoring/alertrules"},
+		{name: "preview", method: http.MethodPost, path: "/api/v1/namespaces/monitoring/alertrules/broken/preview"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+
+			rec := serve(s, tt.method, tt.path, body, nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("code = %d, want 400: %s", rec.Code, rec.Body)
+			}
+			status := decodeStatus(t, rec)
+			if status.Code != http.StatusBadRequest || status.Reason != metav1.StatusReasonInvalid {
+				t.Fatalf("status = %d %s, want 400 Invalid", status.Code, status.Reason)
+			}
+			if !strings.Contains(status.Message, "cpu.rules") || !strings.Contains(status.Message, "HighCPU") {
+				t.Errorf("message %q doesn't name the group and the rule", status.Message)
+			}
+			if status.Details == nil || len(status.Details.Causes) == 0 || status.Details.Causes[0].Field != "spec.groups[0].rules[0].expr" {
+				t.Errorf("details = %+v, want a cause for spec.groups[0].rules[0].expr", status.Details)
+			}
+		})
+	}
+}
+
+func TestAPIStatusInvalid(t *testing.T) {
+	err := apierrors.NewInvalid(schema.GroupKind{Group: "monitoring.kneutral.io", Kind: "AlertRule"}, "broken",
+		field.ErrorList{field.Required(field.NewPath("spec", "groups"), "")})
+
+	status := apiStatus(err)
+	if status.Code != http.StatusBadRequest || status.Reason != metav1.StatusReasonInvalid {
+		t.Errorf("status = %d %s, want 400 Invalid", status.Code, status.Reason)
+	}
+}
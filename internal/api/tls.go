@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+// TLSOptions configures HTTPS serving of the API
+type TLSOptions struct {
+	// CertFile and KeyFile hold the serving certificate and its private key
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile holds the CA bundle client certificates are verified against.
+	// Without one client certificates aren't requested.
+	ClientCAFile string
+
+	// RequireClientCert rejects connections that don't present a client certificate
+	// signed by ClientCAFile
+	RequireClientCert bool
+}
+
+// SetTLS makes Start serve HTTPS. The certificate, key and client CA are read again
+// whenever they change on disk, so rotated certificates are served without a restart.
+func (s *Server) SetTLS(opts TLSOptions) error {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return fmt.Errorf("both a certificate and a key file are required to serve TLS")
+	}
+	if opts.RequireClientCert && opts.ClientCAFile == "" {
+		return fmt.Errorf("a client CA file is required to require client certificates")
+	}
+	s.tls = &opts
+	return nil
+}
+
+// tlsConfig returns the TLS configuration of the server and starts watching its
+// files until ctx is done
+func (s *Server) tlsConfig(ctx context.Context) (*tls.Config, error) {
+	watcher, err := certwatcher.New(s.tls.CertFile, s.tls.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load serving certificate: %w", err)
+	}
+	go func() {
+		if err := watcher.Start(ctx); err != nil {
+			s.log.Error(err, "Serving certificate watcher stopped")
+		}
+	}()
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: watcher.GetCertificate,
+	}
+	if s.tls.ClientCAFile == "" {
+		return config, nil
+	}
+
+	clientCAs := &clientCAPool{file: s.tls.ClientCAFile}
+	if _, err := clientCAs.get(); err != nil {
+		return nil, err
+	}
+	clientAuth := tls.VerifyClientCertIfGiven
+	if s.tls.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := clientCAs.get()
+		if err != nil {
+			return nil, err
+		}
+		perClient := config.Clone()
+		perClient.GetConfigForClient = nil
+		perClient.ClientAuth = clientAuth
+		perClient.ClientCAs = pool
+		return perClient, nil
+	}
+	return config, nil
+}
+
+// clientCAPool is a CA bundle that is read again when the file's modification time changes
+type clientCAPool struct {
+	file string
+
+	mutex   sync.Mutex
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// get returns the current CA pool. A bundle that fails to load after a change keeps
+// the previous pool in use, since cert-manager may be halfway through writing it.
+func (p *clientCAPool) get() (*x509.CertPool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info, err := os.Stat(p.file)
+	if err != nil {
+		if p.pool != nil {
+			return p.pool, nil
+		}
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	if p.pool != nil && info.ModTime().Equal(p.modTime) {
+		return p.pool, nil
+	}
+
+	data, err := os.ReadFile(p.file)
+	if err != nil {
+		if p.pool != nil {
+			return p.pool, nil
+		}
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		if p.pool != nil {
+			return p.pool, nil
+		}
+		return nil, fmt.Errorf("client CA file %s contains no certificates", p.file)
+	}
+	p.pool = pool
+	p.modTime = info.ModTime()
+	return p.pool, nil
+}
+
+// ClientCertAuthenticator identifies callers by a verified TLS client certificate,
+// like the Kubernetes API server: the common name is the user name and the
+// organizations are the groups. Names in the reserved system: namespace are not taken
+// from certificates, so a certificate for "system:masters" grants nothing here even if
+// the client CA is shared with the cluster. Still, every certificate the client CA
+// signs can act as any other user or group, so the CA should be dedicated to the API.
+type ClientCertAuthenticator struct{}
+
+// systemPrefix starts the user and group names Kubernetes reserves for itself
+const systemPrefix = "system:"
+
+// Authenticate implements Authenticator
+func (ClientCertAuthenticator) Authenticate(_ context.Context, r *http.Request) (*authenticationv1.UserInfo, bool, error) {
+	// VerifiedChains is only set for certificates that chain to the client CA
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false, nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" || strings.HasPrefix(cert.Subject.CommonName, systemPrefix) {
+		return nil, false, nil
+	}
+	var groups []string
+	for _, group := range cert.Subject.Organization {
+		if !strings.HasPrefix(group, systemPrefix) {
+			groups = append(groups, group)
+		}
+	}
+	return &authenticationv1.UserInfo{
+		Username: cert.Subject.CommonName,
+		Groups:   groups,
+	}, true, nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientCertAuthenticator(t *testing.T) {
+	tests := []struct {
+		name       string
+		subject    pkix.Name
+		wantOK     bool
+		wantGroups []string
+	}{
+		{name: "user and groups", subject: pkix.Name{CommonName: "alice", Organization: []string{"sre", "oncall"}}, wantOK: true, wantGroups: []string{"sre", "oncall"}},
+		{name: "system groups dropped", subject: pkix.Name{CommonName: "alice", Organization: []string{"system:masters", "sre", "system:nodes"}}, wantOK: true, wantGroups: []string{"sre"}},
+		{name: "system user rejected", subject: pkix.Name{CommonName: "system:kube-controller-manager"}},
+		{name: "no common name", subject: pkix.Name{Organization: []string{"sre"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/alertrules", nil)
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: tt.subject}}}}
+
+			user, ok, err := ClientCertAuthenticator{}.Authenticate(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if user.Username != tt.subject.CommonName {
+				t.Errorf("user = %q, want %q", user.Username, tt.subject.CommonName)
+			}
+			if !reflect.DeepEqual(user.Groups, tt.wantGroups) {
+				t.Errorf("groups = %q, want %q", user.Groups, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestClientCertAuthenticatorUnverified(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/alertrules", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "alice"}}}}
+
+	if _, ok, _ := (ClientCertAuthenticator{}).Authenticate(context.Background(), req); ok {
+		t.Error("unverified certificate authenticated")
+	}
+}
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+const (
+	// watchHistory is how many events are kept to resume watches from
+	watchHistory = 1000
+
+	// subscriberBuffer is how many events a watcher may fall behind before its stream is
+	// closed, after which the client resumes from the last resourceVersion it saw
+	subscriberBuffer = 256
+
+	// defaultWatchTimeout ends watches that don't set timeoutSeconds
+	defaultWatchTimeout = 30 * time.Minute
+
+	// sseHeartbeat is how often an idle Server-Sent Events stream gets a comment line, so
+	// proxies don't drop the connection
+	sseHeartbeat = 30 * time.Second
+)
+
+// WatchSource delivers AlertRule changes. The manager's informer for AlertRules
+// implements it, as does the mock client.
+type WatchSource interface {
+	AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error)
+}
+
+// SetWatchSource enables the watch=true list parameter, streaming the changes source
+// delivers
+func (s *Server) SetWatchSource(source WatchSource) {
+	s.watchSource = source
+}
+
+// WatchEvent is a change streamed to watchers, in the format of the Kubernetes API
+type WatchEvent struct {
+	Type   watch.EventType               `json:"type"`
+	Object *monitoringv1alpha1.AlertRule `json:"object"`
+}
+
+// change is an AlertRule change kept by the watch hub
+type change struct {
+	eventType watch.EventType
+	object    *monitoringv1alpha1.AlertRule
+	// old is the previous state of a modified AlertRule
+	old *monitoringv1alpha1.AlertRule
+	// position orders changes for resuming. It is the highest resourceVersion seen so
+	// far, since deletions carry the last resourceVersion of the deleted object.
+	position uint64
+}
+
+// watchHub fans AlertRule changes from a WatchSource out to the open watches and keeps
+// recent changes so watches can resume from a resourceVersion
+type watchHub struct {
+	mutex       sync.Mutex
+	history     []change
+	latest      uint64
+	floor       uint64
+	subscribers map[chan change]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{subscribers: map[chan change]struct{}{}}
+}
+
+// resourceVersionOf parses a resourceVersion. Kubernetes resourceVersions are opaque, but
+// both the API server and the mock client hand out increasing integers.
+func resourceVersionOf(alertRule *monitoringv1alpha1.AlertRule) uint64 {
+	rv, _ := strconv.ParseUint(alertRule.ResourceVersion, 10, 64)
+	return rv
+}
+
+// OnAdd implements toolscache.ResourceEventHandler
+func (h *watchHub) OnAdd(obj interface{}, isInInitialList bool) {
+	alertRule, ok := obj.(*monitoringv1alpha1.AlertRule)
+	if !ok {
+		return
+	}
+	if isInInitialList {
+		// Objects that existed before the hub started aren't changes to replay; what
+		// happened before them is unknown, so watches can only resume from here on
+		h.mutex.Lock()
+		if rv := resourceVersionOf(alertRule); rv > h.latest {
+			h.latest = rv
+			h.floor = rv
+		}
+		h.mutex.Unlock()
+		return
+	}
+	h.publish(change{eventType: watch.Added, object: alertRule})
+}
+
+// OnUpdate implements toolscache.ResourceEventHandler
+func (h *watchHub) OnUpdate(oldObj, newObj interface{}) {
+	old, ok := oldObj.(*monitoringv1alpha1.AlertRule)
+	if !ok {
+		return
+	}
+	alertRule, ok := newObj.(*monitoringv1alpha1.AlertRule)
+	if !ok || alertRule.ResourceVersion == old.ResourceVersion {
+		// Periodic resyncs deliver unchanged objects
+		return
+	}
+	h.publish(change{eventType: watch.Modified, object: alertRule, old: old})
+}
+
+// OnDelete implements toolscache.ResourceEventHandler
+func (h *watchHub) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	alertRule, ok := obj.(*monitoringv1alpha1.AlertRule)
+	if !ok {
+		return
+	}
+	h.publish(change{eventType: watch.Deleted, object: alertRule})
+}
+
+// publish records a change and hands it to every watch. Watches that fell too far
+// behind are closed.
+func (h *watchHub) publish(c change) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if rv := resourceVersionOf(c.object); rv > h.latest {
+		h.latest = rv
+	}
+	c.position = h.latest
+
+	h.history = append(h.history, c)
+	if len(h.history) > watchHistory {
+		h.floor = h.history[0].position
+		h.history = h.history[1:]
+	}
+
+	for events := range h.subscribers {
+		select {
+		case events <- c:
+		default:
+			delete(h.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// subscribe opens a watch. With a resourceVersion, the changes after it are returned
+// as the backlog; a resourceVersion older than the kept history is expired.
+func (h *watchHub) subscribe(resourceVersion string) (chan change, []change, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var backlog []change
+	if resourceVersion != "" {
+		rv, err := strconv.ParseUint(resourceVersion, 10, 64)
+		if err != nil {
+			return nil, nil, errors.NewBadRequest(fmt.Sprintf("invalid resourceVersion %q", resourceVersion))
+		}
+		if rv < h.floor {
+			return nil, nil, errors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d), list the AlertRules again and watch from the list's resourceVersion", rv, h.floor))
+		}
+		for _, c := range h.history {
+			// Deletions share their position with the change before them, so they are
+			// replayed from that position too; a repeated deletion is harmless
+			if c.position > rv || (c.position == rv && c.eventType == watch.Deleted) {
+				backlog = append(backlog, c)
+			}
+		}
+	}
+
+	events := make(chan change, subscriberBuffer)
+	h.subscribers[events] = struct{}{}
+	return events, backlog, nil
+}
+
+// unsubscribe closes a watch
+func (h *watchHub) unsubscribe(events chan change) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subscribers[events]; ok {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// watchStream writes watch events as newline-delimited JSON or as Server-Sent Events
+type watchStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	sse        bool
+}
+
+// send writes one event and flushes it to the client
+func (ws *watchStream) send(event WatchEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if ws.sse {
+		// The resourceVersion as event ID makes browsers resume with Last-Event-ID
+		_, err = fmt.Fprintf(ws.w, "event: %s\nid: %s\ndata: %s\n\n", event.Type, event.Object.ResourceVersion, data)
+	} else {
+		_, err = fmt.Fprintf(ws.w, "%s\n", data)
+	}
+	if err != nil {
+		return err
+	}
+	return ws.controller.Flush()
+}
+
+// heartbeat keeps an idle Server-Sent Events stream open
+func (ws *watchStream) heartbeat() error {
+	if !ws.sse {
+		return nil
+	}
+	if _, err := fmt.Fprint(ws.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	return ws.controller.Flush()
+}
+
+// isWatch reports whether a list request asks for a watch instead
+func isWatch(r *http.Request) bool {
+	watch, _ := strconv.ParseBool(r.URL.Query().Get("watch"))
+	return watch
+}
+
+// watchAlertRules streams AlertRule changes matching the request's selectors until the
+// client disconnects, timeoutSeconds passes or the server shuts down. Without a
+// resourceVersion the stream starts with an ADDED event for every matching AlertRule.
+func (s *Server) watchAlertRules(w http.ResponseWriter, r *http.Request, namespace string) {
+	if !s.authorize(w, r, "watch", alertRulesResource, namespace, "") {
+		return
+	}
+
+	if s.watches == nil {
+		writeError(w, r, newStatusError(http.StatusNotImplemented, reasonNotImplemented, "Watching AlertRules is not supported by this server"))
+		return
+	}
+
+	query, err := parseListQuery(r, namespace)
+	if err != nil {
+		writeError(w, r, errors.NewBadRequest(err.Error()))
+		return
+	}
+
+	timeout := defaultWatchTimeout
+	if value := r.URL.Query().Get("timeoutSeconds"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 1 {
+			writeError(w, r, errors.NewBadRequest(fmt.Sprintf("invalid timeoutSeconds %q: must be a positive integer", value)))
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	resourceVersion := r.URL.Query().Get("resourceVersion")
+	if lastEventID := r.Header.Get("Last-Event-ID"); sse && lastEventID != "" {
+		resourceVersion = lastEventID
+	}
+	if resourceVersion == "0" {
+		// As with the Kubernetes API, 0 means "any", so start from the current state
+		resourceVersion = ""
+	}
+
+	events, backlog, err := s.watches.subscribe(resourceVersion)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer s.watches.unsubscribe(events)
+
+	ctx := r.Context()
+
+	// Without a resourceVersion, start from the current state. Changes that arrive while
+	// it is listed are already queued, so those older than the listed objects are skipped.
+	listed := map[types.NamespacedName]uint64{}
+	var initial []WatchEvent
+	if resourceVersion == "" {
+		alertRuleList := &monitoringv1alpha1.AlertRuleList{}
+		if err := s.client.List(ctx, alertRuleList, listOptsWithoutPaging(query.opts)...); err != nil {
+			s.logFor(r).Error(err, "Failed to list AlertRules for watch")
+			writeError(w, r, err)
+			return
+		}
+		query.filter(alertRuleList)
+		for i := range alertRuleList.Items {
+			alertRule := &alertRuleList.Items[i]
+			listed[client.ObjectKeyFromObject(alertRule)] = resourceVersionOf(alertRule)
+			initial = append(initial, WatchEvent{Type: watch.Added, Object: alertRule})
+		}
+	}
+
+	// Watches outlive the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		s.logFor(r).Error(err, "Failed to clear the write deadline of a watch")
+	}
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	stream := &watchStream{w: w, controller: controller, sse: sse}
+
+	for _, event := range initial {
+		if err := stream.send(event); err != nil {
+			return
+		}
+	}
+	for _, c := range backlog {
+		if event, ok := query.watchEvent(c); ok {
+			if err := stream.send(event); err != nil {
+				return
+			}
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-timer.C:
+			return
+		case <-heartbeat.C:
+			if err := stream.heartbeat(); err != nil {
+				return
+			}
+		case c, ok := <-events:
+			if !ok {
+				// The watch fell behind; the client resumes from its last resourceVersion
+				return
+			}
+			if rv, found := listed[client.ObjectKeyFromObject(c.object)]; found && c.eventType != watch.Deleted && resourceVersionOf(c.object) <= rv {
+				continue
+			}
+			event, ok := query.watchEvent(c)
+			if !ok {
+				continue
+			}
+			if err := stream.send(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// listOptsWithoutPaging drops limit and continue, which don't apply to the initial
+// state of a watch
+func listOptsWithoutPaging(opts []client.ListOption) []client.ListOption {
+	var filtered []client.ListOption
+	for _, opt := range opts {
+		switch opt.(type) {
+		case client.Limit, client.Continue:
+			continue
+		}
+		filtered = append(filtered, opt)
+	}
+	return filtered
+}
+
+// watchEvent turns a change into the event a watch with these selectors sees. Like
+// the Kubernetes API, an AlertRule that stops matching is DELETED for the watch and
+// one that starts matching is ADDED.
+func (q *listQuery) watchEvent(c change) (WatchEvent, bool) {
+	matches := q.matches(c.object)
+	switch {
+	case c.eventType != watch.Modified:
+		return WatchEvent{Type: c.eventType, Object: c.object}, matches
+	case c.old == nil || q.matches(c.old) == matches:
+		return WatchEvent{Type: watch.Modified, Object: c.object}, matches
+	case matches:
+		return WatchEvent{Type: watch.Added, Object: c.object}, true
+	default:
+		return WatchEvent{Type: watch.Deleted, Object: c.object}, true
+	}
+}
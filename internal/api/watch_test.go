@@ -0,0 +1,326 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/mock"
+)
+
+// watchTestRule returns an AlertRule at the given resourceVersion
+func watchTestRule(name string, resourceVersion int) *monitoringv1alpha1.AlertRule {
+	return &monitoringv1alpha1.AlertRule{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       "monitoring",
+		ResourceVersion: strconv.Itoa(resourceVersion),
+	}}
+}
+
+// describe returns the type, name and resourceVersion of each change
+func describe(changes []change) []string {
+	var described []string
+	for _, c := range changes {
+		described = append(described, string(c.eventType)+" "+c.object.Name+" "+c.object.ResourceVersion)
+	}
+	return described
+}
+
+func TestWatchHubResume(t *testing.T) {
+	hub := newWatchHub()
+	hub.OnAdd(watchTestRule("a", 1), false)
+	hub.OnAdd(watchTestRule("b", 2), false)
+	hub.OnUpdate(watchTestRule("a", 1), watchTestRule("a", 3))
+	// Resyncs deliver unchanged objects, which aren't changes
+	hub.OnUpdate(watchTestRule("a", 3), watchTestRule("a", 3))
+	// A deletion carries the last resourceVersion of the object
+	hub.OnDelete(watchTestRule("b", 2))
+	hub.OnAdd(watchTestRule("c", 4), false)
+
+	tests := []struct {
+		resourceVersion string
+		want            []string
+	}{
+		{resourceVersion: "", want: nil},
+		{resourceVersion: "0", want: []string{"ADDED a 1", "ADDED b 2", "MODIFIED a 3", "DELETED b 2", "ADDED c 4"}},
+		{resourceVersion: "2", want: []string{"MODIFIED a 3", "DELETED b 2", "ADDED c 4"}},
+		// The deletion happened after 3 but shares its position
+		{resourceVersion: "3", want: []string{"DELETED b 2", "ADDED c 4"}},
+		{resourceVersion: "4", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run("from "+tt.resourceVersion, func(t *testing.T) {
+			events, backlog, err := hub.subscribe(tt.resourceVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer hub.unsubscribe(events)
+			if got := describe(backlog); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("backlog = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	events, _, err := hub.subscribe("4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.OnAdd(watchTestRule("d", 5), false)
+	if got := describe([]change{<-events}); got[0] != "ADDED d 5" {
+		t.Errorf("live change = %s, want ADDED d 5", got[0])
+	}
+	hub.unsubscribe(events)
+	if _, ok := <-events; ok {
+		t.Error("events not closed after unsubscribe")
+	}
+}
+
+func TestWatchHubExpired(t *testing.T) {
+	hub := newWatchHub()
+	// Objects listed when the hub started have no history before them
+	hub.OnAdd(watchTestRule("a", 10), true)
+
+	if _, _, err := hub.subscribe("9"); !errors.IsResourceExpired(err) {
+		t.Errorf("resuming before the initial list: err = %v, want Expired", err)
+	}
+	if _, _, err := hub.subscribe("10"); err != nil {
+		t.Errorf("resuming from the initial list: %v", err)
+	}
+	if _, _, err := hub.subscribe("ten"); !errors.IsBadRequest(err) {
+		t.Errorf("invalid resourceVersion: err = %v, want BadRequest", err)
+	}
+
+	// Once the history is full the oldest changes are dropped
+	for rv := 11; rv <= 10+watchHistory+5; rv++ {
+		hub.OnAdd(watchTestRule("r"+strconv.Itoa(rv), rv), false)
+	}
+	if _, _, err := hub.subscribe("12"); !errors.IsResourceExpired(err) {
+		t.Errorf("resuming from a dropped change: err = %v, want Expired", err)
+	}
+	_, backlog, err := hub.subscribe("15")
+	if err != nil {
+		t.Fatalf("resuming from the oldest kept change: %v", err)
+	}
+	if len(backlog) != watchHistory {
+		t.Errorf("backlog has %d changes, want %d", len(backlog), watchHistory)
+	}
+}
+
+func TestWatchHubSlowSubscriber(t *testing.T) {
+	hub := newWatchHub()
+	slow, _, err := hub.subscribe("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, _, err := hub.subscribe("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received int
+	for rv := 1; rv <= subscriberBuffer+1; rv++ {
+		hub.OnAdd(watchTestRule("r"+strconv.Itoa(rv), rv), false)
+		<-fast
+		received++
+	}
+
+	// The slow subscriber gets the buffered changes, then its stream ends
+	var buffered int
+	for range slow {
+		buffered++
+	}
+	if buffered != subscriberBuffer {
+		t.Errorf("slow subscriber got %d changes before being closed, want %d", buffered, subscriberBuffer)
+	}
+	if received != subscriberBuffer+1 {
+		t.Errorf("fast subscriber got %d changes, want %d", received, subscriberBuffer+1)
+	}
+
+	// A closed subscriber can still be unsubscribed, as the handler always does
+	hub.unsubscribe(slow)
+	hub.unsubscribe(fast)
+}
+
+// newWatchTestServer returns a test HTTP server whose AlertRule changes are streamed to
+// watches, as Start sets up
+func newWatchTestServer(t *testing.T) (*httptest.Server, *mock.MockClient) {
+	t.Helper()
+	s, c := newTestServer(t)
+	hub := newWatchHub()
+	if _, err := c.AddEventHandler(hub); err != nil {
+		t.Fatal(err)
+	}
+	s.watches = hub
+	server := httptest.NewServer(s.handler())
+	t.Cleanup(server.Close)
+	return server, c
+}
+
+// openWatch starts a watch and returns its response
+func openWatch(t *testing.T, url string, headers map[string]string) *http.Response {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// relabel changes a label of the AlertRule, causing a MODIFIED change
+func relabel(t *testing.T, c *mock.MockClient, name, namespace string) *monitoringv1alpha1.AlertRule {
+	t.Helper()
+	alertRule := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, alertRule); err != nil {
+		t.Fatal(err)
+	}
+	alertRule.Labels["watched"] = "true"
+	if err := c.Update(context.Background(), alertRule); err != nil {
+		t.Fatal(err)
+	}
+	return alertRule
+}
+
+func TestWatchNDJSON(t *testing.T) {
+	server, c := newWatchTestServer(t)
+	resp := openWatch(t, server.URL+"/api/v1/namespaces/monitoring/alertrules?watch=true", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("code = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() WatchEvent {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("stream ended: %v", lines.Err())
+		}
+		event := WatchEvent{}
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not a watch event: %v", lines.Text(), err)
+		}
+		return event
+	}
+
+	// The current state comes first, one JSON object per line
+	if event := next(); event.Type != watch.Added || event.Object.Name != "cpu-monitoring" {
+		t.Errorf("first event = %s %s, want ADDED cpu-monitoring", event.Type, event.Object.Name)
+	}
+
+	// Changes in other namespaces are filtered out
+	relabel(t, c, "app-performance", "production")
+	updated := relabel(t, c, "cpu-monitoring", "monitoring")
+	event := next()
+	if event.Type != watch.Modified || event.Object.Name != "cpu-monitoring" || event.Object.ResourceVersion != updated.ResourceVersion {
+		t.Errorf("event = %s %s %s, want MODIFIED cpu-monitoring %s", event.Type, event.Object.Name, event.Object.ResourceVersion, updated.ResourceVersion)
+	}
+}
+
+func TestWatchSSE(t *testing.T) {
+	server, c := newWatchTestServer(t)
+	url := server.URL + "/api/v1/namespaces/monitoring/alertrules?watch=true"
+	resp := openWatch(t, url, map[string]string{"Accept": "text/event-stream"})
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	// next reads one event, up to the blank line that ends it
+	next := func(reader *bufio.Reader) (fields map[string]string) {
+		t.Helper()
+		fields = map[string]string{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("stream ended: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return fields
+			}
+			name, value, _ := strings.Cut(line, ": ")
+			fields[name] = value
+		}
+	}
+
+	first := next(reader)
+	if first["event"] != "ADDED" {
+		t.Errorf("event = %q, want ADDED", first["event"])
+	}
+	data := WatchEvent{}
+	if err := json.Unmarshal([]byte(first["data"]), &data); err != nil {
+		t.Fatalf("data %q is not a watch event: %v", first["data"], err)
+	}
+	if first["id"] != data.Object.ResourceVersion {
+		t.Errorf("id = %q, want the resourceVersion %q", first["id"], data.Object.ResourceVersion)
+	}
+
+	updated := relabel(t, c, "cpu-monitoring", "monitoring")
+	modified := next(reader)
+	if modified["event"] != "MODIFIED" || modified["id"] != updated.ResourceVersion {
+		t.Fatalf("event = %s %s, want MODIFIED %s", modified["event"], modified["id"], updated.ResourceVersion)
+	}
+
+	// A reconnecting browser sends the last ID it saw and gets the changes since
+	updated.Labels["watched"] = "again"
+	if err := c.Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	resumed := openWatch(t, url, map[string]string{"Accept": "text/event-stream", "Last-Event-ID": modified["id"]})
+	event := next(bufio.NewReader(resumed.Body))
+	if event["event"] != "MODIFIED" || event["id"] != updated.ResourceVersion {
+		t.Errorf("resumed with %s %s, want MODIFIED %s", event["event"], event["id"], updated.ResourceVersion)
+	}
+}
+
+func TestWatchExpired(t *testing.T) {
+	server, _ := newWatchTestServer(t)
+
+	resp := openWatch(t, server.URL+"/api/v1/alertrules?watch=true&resourceVersion=1", nil)
+	if resp.StatusCode != http.StatusGone {
+		t.Fatalf("code = %d, want 410", resp.StatusCode)
+	}
+	status := &metav1.Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Reason != metav1.StatusReasonExpired {
+		t.Errorf("reason = %q, want Expired", status.Reason)
+	}
+}
+
+func TestWatchTimeout(t *testing.T) {
+	server, _ := newWatchTestServer(t)
+
+	start := time.Now()
+	resp := openWatch(t, server.URL+"/api/v1/alertrules?watch=true&resourceVersion=0&timeoutSeconds=1", nil)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 10*time.Second {
+		t.Errorf("watch ended after %v, want about 1s", elapsed)
+	}
+}
@@ -0,0 +1,143 @@
+// Package metrics defines the operator's own Prometheus metrics. They are registered
+// with the controller-runtime registry and served next to its default metrics.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+const namespace = "kneutral"
+
+var (
+	// PrometheusRuleSizeBytes is the size of the spec of each generated PrometheusRule
+	PrometheusRuleSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "prometheusrule_size_bytes",
+		Help:      "Size in bytes of the JSON encoded spec of each generated PrometheusRule.",
+	}, []string{"namespace", "name"})
+
+	// ValidationFailuresTotal counts rejected AlertRules by reason and by where they were rejected
+	ValidationFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertrule_validation_failures_total",
+		Help:      "Number of AlertRules that failed validation, by reason and by the component that rejected them.",
+	}, []string{"reason", "source"})
+
+	// APIRequestsTotal counts REST API requests by route, method and status code
+	APIRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Number of REST API requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// APIRequestDuration observes REST API latency by route, method and status code
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of REST API requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+// Sources of validation failures
+const (
+	SourceController = "controller"
+	SourceWebhook    = "webhook"
+	SourceAPI        = "api"
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		PrometheusRuleSizeBytes,
+		ValidationFailuresTotal,
+		APIRequestsTotal,
+		APIRequestDuration,
+	)
+}
+
+// RegisterAlertRuleCollector registers the collector that reports AlertRules per state
+// and rules per severity. The counts are taken from the reader on every scrape, so
+// the reader should be the manager's cached client.
+func RegisterAlertRuleCollector(reader client.Reader) error {
+	return ctrlmetrics.Registry.Register(&alertRuleCollector{reader: reader})
+}
+
+var (
+	alertRulesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "alertrules"),
+		"Number of AlertRules by namespace and state.",
+		[]string{"namespace", "state"}, nil,
+	)
+	rulesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "rules"),
+		"Number of alerting and recording rules across all AlertRules by type and severity label.",
+		[]string{"type", "severity"}, nil,
+	)
+	collectErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "alertrule_collector_errors"),
+		"1 if the last scrape failed to list AlertRules, 0 otherwise.",
+		nil, nil,
+	)
+)
+
+// alertRuleCollector reports gauges computed from the current AlertRules
+type alertRuleCollector struct {
+	reader client.Reader
+}
+
+// Describe implements prometheus.Collector
+func (c *alertRuleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- alertRulesDesc
+	ch <- rulesDesc
+	ch <- collectErrorsDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *alertRuleCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	alertRuleList := &monitoringv1alpha1.AlertRuleList{}
+	if err := c.reader.List(ctx, alertRuleList); err != nil {
+		ch <- prometheus.MustNewConstMetric(collectErrorsDesc, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collectErrorsDesc, prometheus.GaugeValue, 0)
+
+	type stateKey struct{ namespace, state string }
+	type ruleKey struct{ ruleType, severity string }
+	states := map[stateKey]float64{}
+	rules := map[ruleKey]float64{}
+
+	for _, alertRule := range alertRuleList.Items {
+		state := string(alertRule.Status.State)
+		if state == "" {
+			state = string(monitoringv1alpha1.AlertRuleStatePending)
+		}
+		states[stateKey{alertRule.Namespace, state}]++
+
+		for _, group := range alertRule.Spec.Groups {
+			for _, rule := range group.Rules {
+				key := ruleKey{ruleType: "alert", severity: rule.Labels["severity"]}
+				if rule.Record != "" {
+					key.ruleType = "record"
+				}
+				rules[key]++
+			}
+		}
+	}
+
+	for key, count := range states {
+		ch <- prometheus.MustNewConstMetric(alertRulesDesc, prometheus.GaugeValue, count, key.namespace, key.state)
+	}
+	for key, count := range rules {
+		ch <- prometheus.MustNewConstMetric(rulesDesc, prometheus.GaugeValue, count, key.ruleType, key.severity)
+	}
+}
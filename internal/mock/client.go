@@ -2,26 +2,46 @@ package mock
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	toolscache "k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/render"
 )
 
 // MockClient implements the controller-runtime client.Client interface for testing
 type MockClient struct {
 	objects map[string]runtime.Object
+	events  []corev1.Event
 	mutex   sync.RWMutex
+
+	// resourceVersion is the last resourceVersion handed out. Like the API server's it
+	// increases with every write, across all objects.
+	resourceVersion uint64
+
+	// handlers are notified of AlertRule changes, like informer event handlers
+	handlers []toolscache.ResourceEventHandler
 }
 
 // NewMockClient creates a new mock client
@@ -38,6 +58,8 @@ func (m *MockClient) objectKey(obj runtime.Object) (string, error) {
 		return fmt.Sprintf("alertrule/%s/%s", v.Namespace, v.Name), nil
 	case *monitoringv1alpha1.AlertRuleList:
 		return "alertrulelist", nil
+	case *monitoringv1.PrometheusRule:
+		return fmt.Sprintf("prometheusrule/%s/%s", v.Namespace, v.Name), nil
 	default:
 		return "", fmt.Errorf("unsupported object type: %T", obj)
 	}
@@ -48,22 +70,31 @@ func (m *MockClient) Get(ctx context.Context, key types.NamespacedName, obj clie
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	objKey := fmt.Sprintf("alertrule/%s/%s", key.Namespace, key.Name)
-	stored, exists := m.objects[objKey]
-	if !exists {
-		return errors.NewNotFound(schema.GroupResource{
-			Group:    "monitoring.kneutral.io",
-			Resource: "alertrules",
-		}, key.Name)
-	}
-
-	// Copy the stored object to the provided object
 	switch v := obj.(type) {
 	case *monitoringv1alpha1.AlertRule:
+		stored, exists := m.objects[fmt.Sprintf("alertrule/%s/%s", key.Namespace, key.Name)]
+		if !exists {
+			return errors.NewNotFound(schema.GroupResource{
+				Group:    "monitoring.kneutral.io",
+				Resource: "alertrules",
+			}, key.Name)
+		}
 		if alertRule, ok := stored.(*monitoringv1alpha1.AlertRule); ok {
 			*v = *alertRule.DeepCopy()
 			return nil
 		}
+	case *monitoringv1.PrometheusRule:
+		stored, exists := m.objects[fmt.Sprintf("prometheusrule/%s/%s", key.Namespace, key.Name)]
+		if !exists {
+			return errors.NewNotFound(schema.GroupResource{
+				Group:    monitoringv1.SchemeGroupVersion.Group,
+				Resource: monitoringv1.PrometheusRuleName,
+			}, key.Name)
+		}
+		if prometheusRule, ok := stored.(*monitoringv1.PrometheusRule); ok {
+			*v = *prometheusRule.DeepCopy()
+			return nil
+		}
 	}
 
 	return fmt.Errorf("type mismatch")
@@ -76,32 +107,90 @@ func (m *MockClient) List(ctx context.Context, list client.ObjectList, opts ...c
 
 	switch v := list.(type) {
 	case *monitoringv1alpha1.AlertRuleList:
-		v.Items = []monitoringv1alpha1.AlertRule{}
+		listOpts := &client.ListOptions{}
+		listOpts.ApplyOptions(opts)
 
-		// Apply namespace filter if specified
-		var namespaceFilter string
-		for _, opt := range opts {
-			if nsOpt, ok := opt.(client.InNamespace); ok {
-				namespaceFilter = string(nsOpt)
-				break
+		// Items are listed in key order, which continue tokens refer to
+		keys := make([]string, 0, len(m.objects))
+		for key := range m.objects {
+			if strings.HasPrefix(key, "alertrule/") {
+				keys = append(keys, key)
 			}
 		}
+		sort.Strings(keys)
 
-		for key, obj := range m.objects {
-			if strings.HasPrefix(key, "alertrule/") {
-				if alertRule, ok := obj.(*monitoringv1alpha1.AlertRule); ok {
-					// Apply namespace filter
-					if namespaceFilter == "" || alertRule.Namespace == namespaceFilter {
-						v.Items = append(v.Items, *alertRule.DeepCopy())
-					}
-				}
+		start := ""
+		if listOpts.Continue != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(listOpts.Continue)
+			if err != nil {
+				return errors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+			}
+			start = string(decoded)
+		}
+
+		v.Items = []monitoringv1alpha1.AlertRule{}
+		v.Continue = ""
+		v.RemainingItemCount = nil
+		var remaining int64
+		for _, key := range keys {
+			if key <= start {
+				continue
+			}
+			alertRule, ok := m.objects[key].(*monitoringv1alpha1.AlertRule)
+			if !ok {
+				continue
+			}
+			if listOpts.Namespace != "" && alertRule.Namespace != listOpts.Namespace {
+				continue
+			}
+			if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(alertRule.Labels)) {
+				continue
+			}
+			if listOpts.FieldSelector != nil && !listOpts.FieldSelector.Matches(monitoringv1alpha1.AlertRuleFields(alertRule)) {
+				continue
+			}
+
+			if listOpts.Limit > 0 && int64(len(v.Items)) >= listOpts.Limit {
+				remaining++
+				continue
+			}
+			v.Items = append(v.Items, *alertRule.DeepCopy())
+			if listOpts.Limit > 0 && int64(len(v.Items)) == listOpts.Limit {
+				v.Continue = base64.RawURLEncoding.EncodeToString([]byte(key))
 			}
 		}
+		if remaining > 0 {
+			v.RemainingItemCount = &remaining
+		} else {
+			// Like the API server, a full last page has no continue token
+			v.Continue = ""
+		}
 
 		v.TypeMeta = metav1.TypeMeta{
 			APIVersion: "monitoring.kneutral.io/v1alpha1",
 			Kind:       "AlertRuleList",
 		}
+		v.ResourceVersion = strconv.FormatUint(m.resourceVersion, 10)
+		return nil
+	case *corev1.EventList:
+		listOpts := &client.ListOptions{}
+		listOpts.ApplyOptions(opts)
+
+		v.Items = []corev1.Event{}
+		for _, event := range m.events {
+			if listOpts.Namespace != "" && event.Namespace != listOpts.Namespace {
+				continue
+			}
+			if listOpts.FieldSelector != nil && !listOpts.FieldSelector.Matches(eventFields(&event)) {
+				continue
+			}
+			v.Items = append(v.Items, *event.DeepCopy())
+		}
+
+		v.TypeMeta = metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "EventList",
+		}
 		return nil
 	}
 
@@ -131,27 +220,31 @@ func (m *MockClient) Create(ctx context.Context, obj client.Object, opts ...clie
 	obj.SetUID(types.UID(fmt.Sprintf("mock-uid-%d", time.Now().UnixNano())))
 	obj.SetGeneration(1)
 
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if len(createOpts.DryRun) > 0 {
+		// Like the API server, a dry run returns the object as it would be created
+		return nil
+	}
+	obj.SetResourceVersion(m.nextResourceVersion())
+
 	// Set status for AlertRule
 	if alertRule, ok := obj.(*monitoringv1alpha1.AlertRule); ok {
 		alertRule.Status = monitoringv1alpha1.AlertRuleStatus{
-			State:              "Active",
 			PrometheusRuleName: fmt.Sprintf("kneutral-%s", alertRule.Name),
-			LastReconcileTime:  &metav1.Time{Time: time.Now()},
-			Conditions: []metav1.Condition{
-				{
-					Type:               "Ready",
-					Status:             metav1.ConditionTrue,
-					ObservedGeneration: 1,
-					LastTransitionTime: metav1.NewTime(time.Now()),
-					Reason:             "MockReconcileSuccess",
-					Message:            fmt.Sprintf("Mock PrometheusRule %s created successfully", fmt.Sprintf("kneutral-%s", alertRule.Name)),
-				},
-			},
 		}
+		mockReconcile(alertRule, monitoringv1alpha1.ReasonCreated, fmt.Sprintf("Mock PrometheusRule %s created successfully", alertRule.Status.PrometheusRuleName))
+		m.storePrometheusRule(alertRule)
+		m.recordEvent(alertRule, monitoringv1alpha1.ReasonCreated, fmt.Sprintf("PrometheusRule %s created", alertRule.Status.PrometheusRuleName))
 	}
 
 	// Store a deep copy
 	m.objects[key] = obj.DeepCopyObject()
+	if alertRule, ok := m.objects[key].(*monitoringv1alpha1.AlertRule); ok {
+		for _, handler := range m.handlers {
+			handler.OnAdd(alertRule.DeepCopy(), false)
+		}
+	}
 	return nil
 }
 
@@ -160,6 +253,14 @@ func (m *MockClient) Update(ctx context.Context, obj client.Object, opts ...clie
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	updateOpts := &client.UpdateOptions{}
+	updateOpts.ApplyOptions(opts)
+	return m.update(obj, len(updateOpts.DryRun) > 0)
+}
+
+// update stores obj over the existing object, or only checks that it could with
+// dryRun. The caller must hold the write lock.
+func (m *MockClient) update(obj client.Object, dryRun bool) error {
 	key, err := m.objectKey(obj)
 	if err != nil {
 		return err
@@ -176,30 +277,122 @@ func (m *MockClient) Update(ctx context.Context, obj client.Object, opts ...clie
 
 	// Update generation
 	if existingObj, ok := existing.(client.Object); ok {
+		// An empty resourceVersion is an unconditional update, as with the API server
+		if obj.GetResourceVersion() != "" && obj.GetResourceVersion() != existingObj.GetResourceVersion() {
+			return conflict(obj.GetName())
+		}
 		obj.SetGeneration(existingObj.GetGeneration() + 1)
 		obj.SetCreationTimestamp(existingObj.GetCreationTimestamp())
 		obj.SetUID(existingObj.GetUID())
+		if dryRun {
+			obj.SetResourceVersion(existingObj.GetResourceVersion())
+			return nil
+		}
 	}
+	obj.SetResourceVersion(m.nextResourceVersion())
 
 	// Update status for AlertRule
 	if alertRule, ok := obj.(*monitoringv1alpha1.AlertRule); ok {
-		alertRule.Status.LastReconcileTime = &metav1.Time{Time: time.Now()}
-		// Keep existing conditions and add update condition
-		alertRule.Status.Conditions = append(alertRule.Status.Conditions, metav1.Condition{
-			Type:               "Updated",
-			Status:             metav1.ConditionTrue,
-			ObservedGeneration: obj.GetGeneration(),
-			LastTransitionTime: metav1.NewTime(time.Now()),
-			Reason:             "MockUpdateSuccess",
-			Message:            fmt.Sprintf("Mock AlertRule %s updated successfully", alertRule.Name),
-		})
+		mockReconcile(alertRule, monitoringv1alpha1.ReasonUpdated, fmt.Sprintf("Mock AlertRule %s updated successfully", alertRule.Name))
+		m.storePrometheusRule(alertRule)
+		m.recordEvent(alertRule, monitoringv1alpha1.ReasonUpdated, fmt.Sprintf("PrometheusRule %s updated", alertRule.Status.PrometheusRuleName))
 	}
 
 	// Store the updated object
 	m.objects[key] = obj.DeepCopyObject()
+	if alertRule, ok := m.objects[key].(*monitoringv1alpha1.AlertRule); ok {
+		old := existing.(*monitoringv1alpha1.AlertRule)
+		for _, handler := range m.handlers {
+			handler.OnUpdate(old.DeepCopy(), alertRule.DeepCopy())
+		}
+	}
 	return nil
 }
 
+// storePrometheusRule stores the PrometheusRule the operator would generate for an
+// AlertRule. The caller must hold the write lock.
+func (m *MockClient) storePrometheusRule(alertRule *monitoringv1alpha1.AlertRule) {
+	prometheusRule := render.GeneratePrometheusRule(alertRule)
+	prometheusRule.UID = types.UID(fmt.Sprintf("mock-uid-%d", time.Now().UnixNano()))
+	prometheusRule.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(alertRule, monitoringv1alpha1.GroupVersion.WithKind("AlertRule")),
+	}
+	prometheusRule.ResourceVersion = m.nextResourceVersion()
+	m.objects[fmt.Sprintf("prometheusrule/%s/%s", prometheusRule.Namespace, prometheusRule.Name)] = prometheusRule
+}
+
+// nextResourceVersion returns a new resourceVersion. The caller must hold the write lock.
+func (m *MockClient) nextResourceVersion() string {
+	m.resourceVersion++
+	return strconv.FormatUint(m.resourceVersion, 10)
+}
+
+// conflict returns the error the API server gives for a write based on a stale resourceVersion
+func conflict(name string) error {
+	return errors.NewConflict(schema.GroupResource{
+		Group:    "monitoring.kneutral.io",
+		Resource: "alertrules",
+	}, name, fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+}
+
+// mockReconcile simulates the status the controller writes after a successful sync
+func mockReconcile(alertRule *monitoringv1alpha1.AlertRule, syncReason, message string) {
+	now := metav1.NewTime(time.Now())
+	alertRule.Status.State = monitoringv1alpha1.AlertRuleStateActive
+	alertRule.Status.LastReconcileTime = &now
+
+	conditions := []metav1.Condition{
+		{Type: monitoringv1alpha1.ConditionValidated, Status: metav1.ConditionTrue, Reason: monitoringv1alpha1.ReasonValid, Message: "AlertRule spec is valid"},
+		{Type: monitoringv1alpha1.ConditionSynced, Status: metav1.ConditionTrue, Reason: syncReason, Message: message},
+		{Type: monitoringv1alpha1.ConditionLoadedByPrometheus, Status: metav1.ConditionUnknown, Reason: monitoringv1alpha1.ReasonNotChecked, Message: "Prometheus rule health is not checked in standalone mode"},
+		{Type: monitoringv1alpha1.ConditionReady, Status: metav1.ConditionTrue, Reason: "MockReconcileSuccess", Message: message},
+	}
+	for _, condition := range conditions {
+		condition.ObservedGeneration = alertRule.Generation
+		condition.LastTransitionTime = now
+		meta.SetStatusCondition(&alertRule.Status.Conditions, condition)
+	}
+}
+
+// recordEvent stores the Normal event the controller would emit for a successful sync
+func (m *MockClient) recordEvent(alertRule *monitoringv1alpha1.AlertRule, reason, message string) {
+	now := metav1.NewTime(time.Now())
+	m.events = append(m.events, corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("%s.%x", alertRule.Name, now.UnixNano()),
+			Namespace:         alertRule.Namespace,
+			CreationTimestamp: now,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "AlertRule",
+			APIVersion: monitoringv1alpha1.GroupVersion.String(),
+			Namespace:  alertRule.Namespace,
+			Name:       alertRule.Name,
+			UID:        alertRule.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: "kneutral-operator"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	})
+}
+
+// eventFields returns the fields of an event that can be used in field selectors
+func eventFields(event *corev1.Event) fields.Set {
+	return fields.Set{
+		"metadata.name":       event.Name,
+		"metadata.namespace":  event.Namespace,
+		"involvedObject.kind": event.InvolvedObject.Kind,
+		"involvedObject.name": event.InvolvedObject.Name,
+		"involvedObject.uid":  string(event.InvolvedObject.UID),
+		"reason":              event.Reason,
+		"type":                event.Type,
+	}
+}
+
 // Delete deletes an object
 func (m *MockClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
 	m.mutex.Lock()
@@ -211,22 +404,179 @@ func (m *MockClient) Delete(ctx context.Context, obj client.Object, opts ...clie
 	}
 
 	// Check if object exists
-	if _, exists := m.objects[key]; !exists {
+	stored, exists := m.objects[key]
+	if !exists {
 		return errors.NewNotFound(schema.GroupResource{
 			Group:    "monitoring.kneutral.io",
 			Resource: "alertrules",
 		}, obj.GetName())
 	}
 
+	deleteOpts := &client.DeleteOptions{}
+	deleteOpts.ApplyOptions(opts)
+	if preconditions := deleteOpts.Preconditions; preconditions != nil {
+		storedObj := stored.(client.Object)
+		if preconditions.ResourceVersion != nil && *preconditions.ResourceVersion != storedObj.GetResourceVersion() {
+			return conflict(obj.GetName())
+		}
+		if preconditions.UID != nil && *preconditions.UID != storedObj.GetUID() {
+			return conflict(obj.GetName())
+		}
+	}
+
+	if len(deleteOpts.DryRun) > 0 {
+		return nil
+	}
+
 	// Delete the object
 	delete(m.objects, key)
+	if alertRule, ok := stored.(*monitoringv1alpha1.AlertRule); ok {
+		// The PrometheusRule is garbage collected along with its owner
+		delete(m.objects, fmt.Sprintf("prometheusrule/%s/kneutral-%s", alertRule.Namespace, alertRule.Name))
+		for _, handler := range m.handlers {
+			handler.OnDelete(alertRule.DeepCopy())
+		}
+	}
 	return nil
 }
 
-// Patch patches an object (simplified implementation)
+// AddEventHandler notifies handler of AlertRule changes, like an informer does. The
+// existing AlertRules are delivered first as the initial list.
+func (m *MockClient) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, obj := range m.objects {
+		if alertRule, ok := obj.(*monitoringv1alpha1.AlertRule); ok {
+			handler.OnAdd(alertRule.DeepCopy(), true)
+		}
+	}
+	m.handlers = append(m.handlers, handler)
+	return mockRegistration{}, nil
+}
+
+// mockRegistration implements toolscache.ResourceEventHandlerRegistration. The mock
+// delivers the initial list before AddEventHandler returns, so it has always synced.
+type mockRegistration struct{}
+
+func (mockRegistration) HasSynced() bool {
+	return true
+}
+
+// Patch applies a merge, JSON or strategic merge patch to the stored object and
+// returns the result in obj, like the API server does
 func (m *MockClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
-	// For mock purposes, just treat patch as update
-	return m.Update(ctx, obj, nil)
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	return m.patch(obj, patch, patchOpts, false)
+}
+
+// patch applies patch to the stored object. With status only the patched status is
+// kept, as for the status subresource.
+func (m *MockClient) patch(obj client.Object, patch client.Patch, opts *client.PatchOptions, status bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	alertRule, ok := obj.(*monitoringv1alpha1.AlertRule)
+	if !ok {
+		return fmt.Errorf("unsupported object type: %T", obj)
+	}
+
+	key, err := m.objectKey(obj)
+	if err != nil {
+		return err
+	}
+	stored, exists := m.objects[key]
+	if !exists {
+		return errors.NewNotFound(schema.GroupResource{
+			Group:    "monitoring.kneutral.io",
+			Resource: "alertrules",
+		}, obj.GetName())
+	}
+
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	original, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	switch patch.Type() {
+	case types.MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, data)
+	case types.JSONPatchType:
+		var decoded jsonpatch.Patch
+		if decoded, err = jsonpatch.DecodePatch(data); err == nil {
+			patched, err = decoded.Apply(original)
+		}
+	case types.StrategicMergePatchType:
+		patched, err = strategicpatch.StrategicMergePatch(original, data, &monitoringv1alpha1.AlertRule{})
+	default:
+		return errors.NewBadRequest(fmt.Sprintf("patch type %q is not supported by the mock client", patch.Type()))
+	}
+	if err != nil {
+		return errors.NewBadRequest(fmt.Sprintf("failed to apply patch: %v", err))
+	}
+
+	result := monitoringv1alpha1.AlertRule{}
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return errors.NewBadRequest(fmt.Sprintf("patched object is invalid: %v", err))
+	}
+	if result.Name != alertRule.Name || result.Namespace != alertRule.Namespace {
+		return errors.NewBadRequest("metadata.name and metadata.namespace can't be patched")
+	}
+	// A resourceVersion in the patch, as sent by optimistic lock patches, must still be
+	// current; update then checks the result against the stored object
+	if result.ResourceVersion == "" {
+		result.ResourceVersion = stored.(client.Object).GetResourceVersion()
+	}
+
+	if status {
+		patchedStatus := result.Status
+		result = *stored.(*monitoringv1alpha1.AlertRule).DeepCopy()
+		result.Status = patchedStatus
+		*alertRule = result
+		return m.updateStatus(alertRule, len(opts.DryRun) > 0)
+	}
+	*alertRule = result
+	return m.update(alertRule, len(opts.DryRun) > 0)
+}
+
+// updateStatus stores the status of obj over the existing object, leaving the spec and
+// generation alone, or only checks that it could with dryRun. The caller must hold the
+// write lock.
+func (m *MockClient) updateStatus(alertRule *monitoringv1alpha1.AlertRule, dryRun bool) error {
+	key, err := m.objectKey(alertRule)
+	if err != nil {
+		return err
+	}
+	existing, exists := m.objects[key].(*monitoringv1alpha1.AlertRule)
+	if !exists {
+		return errors.NewNotFound(schema.GroupResource{
+			Group:    "monitoring.kneutral.io",
+			Resource: "alertrules",
+		}, alertRule.Name)
+	}
+	if alertRule.ResourceVersion != "" && alertRule.ResourceVersion != existing.ResourceVersion {
+		return conflict(alertRule.Name)
+	}
+
+	updated := existing.DeepCopy()
+	updated.Status = *alertRule.Status.DeepCopy()
+	if dryRun {
+		updated.DeepCopyInto(alertRule)
+		return nil
+	}
+	updated.ResourceVersion = m.nextResourceVersion()
+	m.objects[key] = updated
+	for _, handler := range m.handlers {
+		handler.OnUpdate(existing.DeepCopy(), updated.DeepCopy())
+	}
+	updated.DeepCopyInto(alertRule)
+	return nil
 }
 
 // DeleteAllOf deletes all objects matching the given options
@@ -254,12 +604,11 @@ type mockStatusWriter struct {
 
 func (m *mockStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
 	// For mock purposes, just update the object
-	return m.client.Update(ctx, obj, nil)
+	return m.client.Update(ctx, obj)
 }
 
 func (m *mockStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
-	// For mock purposes, just update the object
-	return m.client.Update(ctx, obj, nil)
+	return m.client.SubResource("status").Patch(ctx, obj, patch, opts...)
 }
 
 func (m *mockStatusWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
@@ -324,9 +673,11 @@ func (m *mockSubResourceClient) Create(ctx context.Context, obj client.Object, s
 }
 
 func (m *mockSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
-	return m.client.Update(ctx, obj, nil)
+	return m.client.Update(ctx, obj)
 }
 
 func (m *mockSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
-	return m.client.Patch(ctx, obj, patch, nil)
+	patchOpts := &client.SubResourcePatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	return m.client.patch(obj, patch, &patchOpts.PatchOptions, m.subresource == "status")
 }
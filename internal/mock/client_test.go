@@ -0,0 +1,277 @@
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// newPatchTestClient returns a client holding one AlertRule with two groups
+func newPatchTestClient(t *testing.T) (*MockClient, *monitoringv1alpha1.AlertRule) {
+	t.Helper()
+	c := NewMockClient()
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cpu",
+			Namespace: "monitoring",
+			Labels:    map[string]string{"team": "platform", "tier": "infra"},
+		},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Groups: []monitoringv1alpha1.AlertGroup{
+				{Name: "cpu.rules", Interval: "30s", Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 80"}}},
+				{Name: "load.rules", Rules: []monitoringv1alpha1.Rule{{Alert: "HighLoad", Expr: "load > 4"}}},
+			},
+		},
+	}
+	if err := c.Create(context.Background(), alertRule); err != nil {
+		t.Fatal(err)
+	}
+	return c, alertRule
+}
+
+// groupNames returns the names of the groups of alertRule, in order
+func groupNames(alertRule *monitoringv1alpha1.AlertRule) []string {
+	var names []string
+	for _, group := range alertRule.Spec.Groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		patchType  types.PatchType
+		patch      string
+		wantErr    func(error) bool
+		wantLabels map[string]string
+		wantGroups []string
+		check      func(t *testing.T, got *monitoringv1alpha1.AlertRule)
+	}{
+		{
+			name:       "merge patch sets and removes labels",
+			patchType:  types.MergePatchType,
+			patch:      `{"metadata":{"labels":{"team":"sre","tier":null}}}`,
+			wantLabels: map[string]string{"team": "sre"},
+			wantGroups: []string{"cpu.rules", "load.rules"},
+		},
+		{
+			name:       "merge patch replaces lists",
+			patchType:  types.MergePatchType,
+			patch:      `{"spec":{"groups":[{"name":"load.rules","interval":"1m","rules":[{"alert":"HighLoad","expr":"load > 8"}]}]}}`,
+			wantLabels: map[string]string{"team": "platform", "tier": "infra"},
+			wantGroups: []string{"load.rules"},
+			check: func(t *testing.T, got *monitoringv1alpha1.AlertRule) {
+				if got.Spec.Groups[0].Interval != "1m" {
+					t.Errorf("interval = %q, want 1m", got.Spec.Groups[0].Interval)
+				}
+			},
+		},
+		{
+			name:       "JSON patch",
+			patchType:  types.JSONPatchType,
+			patch:      `[{"op":"replace","path":"/spec/groups/0/interval","value":"1m"},{"op":"remove","path":"/spec/groups/1"}]`,
+			wantLabels: map[string]string{"team": "platform", "tier": "infra"},
+			wantGroups: []string{"cpu.rules"},
+			check: func(t *testing.T, got *monitoringv1alpha1.AlertRule) {
+				if got.Spec.Groups[0].Interval != "1m" {
+					t.Errorf("interval = %q, want 1m", got.Spec.Groups[0].Interval)
+				}
+			},
+		},
+		{
+			name:       "JSON patch with a passing test op",
+			patchType:  types.JSONPatchType,
+			patch:      `[{"op":"test","path":"/spec/groups/0/name","value":"cpu.rules"},{"op":"add","path":"/metadata/labels/env","value":"prod"}]`,
+			wantLabels: map[string]string{"team": "platform", "tier": "infra", "env": "prod"},
+			wantGroups: []string{"cpu.rules", "load.rules"},
+		},
+		{
+			name:      "JSON patch with a failing test op",
+			patchType: types.JSONPatchType,
+			patch:     `[{"op":"test","path":"/spec/groups/0/name","value":"memory.rules"},{"op":"remove","path":"/spec/groups/0"}]`,
+			wantErr:   errors.IsBadRequest,
+		},
+		{
+			name:      "JSON patch of a missing path",
+			patchType: types.JSONPatchType,
+			patch:     `[{"op":"replace","path":"/spec/groups/5/interval","value":"1m"}]`,
+			wantErr:   errors.IsBadRequest,
+		},
+		{
+			name:       "strategic merge patch merges groups by name",
+			patchType:  types.StrategicMergePatchType,
+			patch:      `{"spec":{"groups":[{"name":"load.rules","interval":"1m"},{"name":"memory.rules","rules":[{"alert":"HighMemory","expr":"mem > 90"}]}]}}`,
+			wantLabels: map[string]string{"team": "platform", "tier": "infra"},
+			wantGroups: []string{"cpu.rules", "load.rules", "memory.rules"},
+			check: func(t *testing.T, got *monitoringv1alpha1.AlertRule) {
+				load := got.Spec.Groups[1]
+				if load.Interval != "1m" || len(load.Rules) != 1 || load.Rules[0].Alert != "HighLoad" {
+					t.Errorf("load.rules = %+v, want interval 1m and its rule kept", load)
+				}
+			},
+		},
+		{
+			name:       "strategic merge patch deletes a group",
+			patchType:  types.StrategicMergePatchType,
+			patch:      `{"spec":{"groups":[{"name":"cpu.rules","$patch":"delete"}]}}`,
+			wantLabels: map[string]string{"team": "platform", "tier": "infra"},
+			wantGroups: []string{"load.rules"},
+		},
+		{
+			name:      "name can't be patched",
+			patchType: types.MergePatchType,
+			patch:     `{"metadata":{"name":"other"}}`,
+			wantErr:   errors.IsBadRequest,
+		},
+		{
+			name:      "stale resourceVersion",
+			patchType: types.MergePatchType,
+			patch:     `{"metadata":{"resourceVersion":"0","labels":{"team":"sre"}}}`,
+			wantErr:   errors.IsConflict,
+		},
+		{
+			name:      "apply patch",
+			patchType: types.ApplyPatchType,
+			patch:     `{}`,
+			wantErr:   errors.IsBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, created := newPatchTestClient(t)
+			key := client.ObjectKeyFromObject(created)
+
+			obj := &monitoringv1alpha1.AlertRule{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+			err := c.Patch(context.Background(), obj, client.RawPatch(tt.patchType, []byte(tt.patch)))
+
+			got := &monitoringv1alpha1.AlertRule{}
+			if getErr := c.Get(context.Background(), key, got); getErr != nil {
+				t.Fatal(getErr)
+			}
+			if tt.wantErr != nil {
+				if err == nil || !tt.wantErr(err) {
+					t.Fatalf("err = %v, not the expected error", err)
+				}
+				if got.ResourceVersion != created.ResourceVersion {
+					t.Errorf("a failed patch changed the AlertRule")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got.Labels, tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", got.Labels, tt.wantLabels)
+			}
+			if names := groupNames(got); !reflect.DeepEqual(names, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", names, tt.wantGroups)
+			}
+			if got.Generation != created.Generation+1 || got.ResourceVersion == created.ResourceVersion {
+				t.Errorf("generation %d, resourceVersion %s after patch, was %d, %s", got.Generation, got.ResourceVersion, created.Generation, created.ResourceVersion)
+			}
+			if obj.ResourceVersion != got.ResourceVersion {
+				t.Errorf("patched object has resourceVersion %s, stored %s", obj.ResourceVersion, got.ResourceVersion)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestPatchDryRun(t *testing.T) {
+	c, created := newPatchTestClient(t)
+	obj := &monitoringv1alpha1.AlertRule{ObjectMeta: metav1.ObjectMeta{Name: created.Name, Namespace: created.Namespace}}
+
+	err := c.Patch(context.Background(), obj, client.RawPatch(types.MergePatchType, []byte(`{"metadata":{"labels":{"team":"sre"}}}`)), client.DryRunAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Labels["team"] != "sre" {
+		t.Errorf("dry run returned labels %v, want the patched ones", obj.Labels)
+	}
+
+	got := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(created), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Labels["team"] != "platform" || got.ResourceVersion != created.ResourceVersion {
+		t.Errorf("dry run stored the patch: labels %v, resourceVersion %s", got.Labels, got.ResourceVersion)
+	}
+}
+
+func TestPatchNotFound(t *testing.T) {
+	c := NewMockClient()
+	obj := &monitoringv1alpha1.AlertRule{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "monitoring"}}
+
+	err := c.Patch(context.Background(), obj, client.RawPatch(types.MergePatchType, []byte(`{}`)))
+	if !errors.IsNotFound(err) {
+		t.Errorf("err = %v, want NotFound", err)
+	}
+}
+
+func TestStatusPatch(t *testing.T) {
+	c, created := newPatchTestClient(t)
+	patch := client.RawPatch(types.MergePatchType, []byte(`{"spec":{"groups":[]},"status":{"state":"Degraded"}}`))
+
+	obj := &monitoringv1alpha1.AlertRule{ObjectMeta: metav1.ObjectMeta{Name: created.Name, Namespace: created.Namespace}}
+	if err := c.Status().Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(created), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.State != monitoringv1alpha1.AlertRuleStateDegraded {
+		t.Errorf("state = %q, want the patched Degraded", got.Status.State)
+	}
+	if !reflect.DeepEqual(groupNames(got), groupNames(created)) || got.Generation != created.Generation {
+		t.Errorf("status patch changed the spec: groups %v, generation %d", groupNames(got), got.Generation)
+	}
+	if got.ResourceVersion == created.ResourceVersion || obj.ResourceVersion != got.ResourceVersion {
+		t.Errorf("resourceVersion = %s, returned %s, want a new one over %s", got.ResourceVersion, obj.ResourceVersion, created.ResourceVersion)
+	}
+}
+
+func TestSubResourcePatchOptions(t *testing.T) {
+	c, created := newPatchTestClient(t)
+	patch := client.RawPatch(types.MergePatchType, []byte(`{"status":{"state":"Degraded"}}`))
+
+	obj := &monitoringv1alpha1.AlertRule{ObjectMeta: metav1.ObjectMeta{Name: created.Name, Namespace: created.Namespace}}
+	if err := c.SubResource("status").Patch(context.Background(), obj, patch, client.DryRunAll); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Status.State != monitoringv1alpha1.AlertRuleStateDegraded {
+		t.Errorf("dry run returned state %q, want the patched Degraded", obj.Status.State)
+	}
+
+	got := &monitoringv1alpha1.AlertRule{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(created), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.State == monitoringv1alpha1.AlertRuleStateDegraded || got.ResourceVersion != created.ResourceVersion {
+		t.Errorf("dry run stored the patch: state %q, resourceVersion %s", got.Status.State, got.ResourceVersion)
+	}
+
+	// Without options the patch is stored
+	if err := c.SubResource("status").Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(created), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.State != monitoringv1alpha1.AlertRuleStateDegraded {
+		t.Errorf("state = %q, want the patched Degraded", got.Status.State)
+	}
+}
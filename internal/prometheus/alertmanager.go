@@ -0,0 +1,74 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertmanagerAlert is an alert as returned by the Alertmanager /api/v2/alerts endpoint
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    *time.Time        `json:"startsAt,omitempty"`
+	Status      struct {
+		// State is "active", "suppressed" or "unprocessed"
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+// AlertmanagerClient queries the Alertmanager v2 API
+type AlertmanagerClient struct {
+	baseURL    string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+
+	mutex         sync.Mutex
+	alerts        []Alert
+	alertsFetched time.Time
+}
+
+var _ AlertSource = &AlertmanagerClient{}
+
+// NewAlertmanagerClient creates a new Alertmanager client. Responses are cached for
+// cacheTTL in the same way as the Prometheus client.
+func NewAlertmanagerClient(baseURL string, cacheTTL time.Duration) *AlertmanagerClient {
+	return &AlertmanagerClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:   cacheTTL,
+	}
+}
+
+// Alerts returns the alerts Alertmanager has received and not yet resolved. Alertmanager
+// only sees alerts once they fire, so every alert is reported as firing, including
+// silenced and inhibited ones.
+func (c *AlertmanagerClient) Alerts(ctx context.Context) ([]Alert, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.alerts != nil && time.Since(c.alertsFetched) < c.cacheTTL {
+		return c.alerts, nil
+	}
+
+	var resp []alertmanagerAlert
+	if err := get(ctx, c.httpClient, c.baseURL+"/api/v2/alerts?active=true&silenced=true&inhibited=true", &resp); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]Alert, 0, len(resp))
+	for _, a := range resp {
+		alerts = append(alerts, Alert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       "firing",
+			ActiveAt:    a.StartsAt,
+		})
+	}
+
+	c.alerts = alerts
+	c.alertsFetched = time.Now()
+	return c.alerts, nil
+}
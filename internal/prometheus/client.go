@@ -0,0 +1,161 @@
+// Package prometheus contains a minimal client for the parts of the Prometheus HTTP API
+// the operator uses to report on generated rules.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RuleGroup is a rule group as returned by /api/v1/rules
+type RuleGroup struct {
+	Name           string    `json:"name"`
+	File           string    `json:"file"`
+	Rules          []Rule    `json:"rules"`
+	Interval       float64   `json:"interval"`
+	EvaluationTime float64   `json:"evaluationTime"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+}
+
+// Rule is an alerting or recording rule as returned by /api/v1/rules
+type Rule struct {
+	Name           string    `json:"name"`
+	Query          string    `json:"query"`
+	Type           string    `json:"type"`
+	Health         string    `json:"health"`
+	LastError      string    `json:"lastError,omitempty"`
+	EvaluationTime float64   `json:"evaluationTime"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+	// Alerts are the pending and firing alerts of an alerting rule
+	Alerts []Alert `json:"alerts,omitempty"`
+}
+
+// Alert is an alert that is currently pending or firing
+type Alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	// State is "pending" or "firing"
+	State    string     `json:"state"`
+	ActiveAt *time.Time `json:"activeAt,omitempty"`
+}
+
+// AlertSource lists the alerts that are currently pending or firing
+type AlertSource interface {
+	Alerts(ctx context.Context) ([]Alert, error)
+}
+
+// rulesResponse is the envelope of the /api/v1/rules response
+type rulesResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Data      struct {
+		Groups []RuleGroup `json:"groups"`
+	} `json:"data"`
+}
+
+// alertsResponse is the envelope of the /api/v1/alerts response
+type alertsResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Data      struct {
+		Alerts []Alert `json:"alerts"`
+	} `json:"data"`
+}
+
+// Client queries the Prometheus HTTP API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+
+	mutex         sync.Mutex
+	groups        []RuleGroup
+	groupsFetched time.Time
+	alerts        []Alert
+	alertsFetched time.Time
+}
+
+var _ AlertSource = &Client{}
+
+// NewClient creates a new Prometheus client. Responses from /api/v1/rules are cached
+// for cacheTTL so that reconciling many AlertRules doesn't fetch every rule each time.
+func NewClient(baseURL string, cacheTTL time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:   cacheTTL,
+	}
+}
+
+// Rules returns the rule groups Prometheus has loaded
+func (c *Client) Rules(ctx context.Context) ([]RuleGroup, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.groups != nil && time.Since(c.groupsFetched) < c.cacheTTL {
+		return c.groups, nil
+	}
+
+	var resp rulesResponse
+	if err := get(ctx, c.httpClient, c.baseURL+"/api/v1/rules", &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("prometheus returned %s: %s", resp.ErrorType, resp.Error)
+	}
+
+	c.groups = resp.Data.Groups
+	c.groupsFetched = time.Now()
+	return c.groups, nil
+}
+
+// Alerts returns the alerts Prometheus currently has pending or firing
+func (c *Client) Alerts(ctx context.Context) ([]Alert, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.alerts != nil && time.Since(c.alertsFetched) < c.cacheTTL {
+		return c.alerts, nil
+	}
+
+	var resp alertsResponse
+	if err := get(ctx, c.httpClient, c.baseURL+"/api/v1/alerts", &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("prometheus returned %s: %s", resp.ErrorType, resp.Error)
+	}
+
+	c.alerts = resp.Data.Alerts
+	c.alertsFetched = time.Now()
+	return c.alerts, nil
+}
+
+// get performs a GET request and decodes the JSON response
+func get(ctx context.Context, httpClient *http.Client, url string, into interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The Prometheus API also returns a JSON body with an error status for failed
+	// requests, so the status code only matters when the body isn't an API response
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("unexpected response from %s (status %d): %w", url, resp.StatusCode, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer serves an empty rules response and counts the requests it gets
+func countingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"groups":[{"name":"cpu.rules","file":"a.yaml","rules":[]}]}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRulesCache(t *testing.T) {
+	server, requests := countingServer(t)
+	client := NewClient(server.URL+"/", time.Hour)
+
+	for i := 0; i < 3; i++ {
+		groups, err := client.Rules(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || groups[0].Name != "cpu.rules" {
+			t.Fatalf("groups = %+v", groups)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests within the TTL = %d, want 1", got)
+	}
+}
+
+func TestRulesCacheExpires(t *testing.T) {
+	server, requests := countingServer(t)
+	client := NewClient(server.URL, 10*time.Millisecond)
+
+	if _, err := client.Rules(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.Rules(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests across an expired TTL = %d, want 2", got)
+	}
+}
+
+func TestRulesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"status":"error","errorType":"unavailable","error":"rule manager not ready"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, time.Hour)
+	if _, err := client.Rules(context.Background()); err == nil {
+		t.Fatal("expected an error for an error response")
+	}
+}
+
+func TestRulesNotAPIResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, time.Hour)
+	if _, err := client.Rules(context.Background()); err == nil {
+		t.Fatal("expected an error for a response that isn't JSON")
+	}
+}
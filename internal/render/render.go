@@ -0,0 +1,104 @@
+// Package render turns AlertRules into the PrometheusRules the operator applies. It is
+// shared by the controller, the REST API previews and exports, and the mock client.
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// Labels the operator sets on every PrometheusRule it generates
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	InstanceLabel  = "app.kubernetes.io/instance"
+	NameLabel      = "app.kubernetes.io/name"
+)
+
+// SpecHashAnnotation records the hash of the spec the operator last applied to a PrometheusRule
+const SpecHashAnnotation = "kneutral.io/spec-hash"
+
+// SpecHash returns a content hash of a PrometheusRule spec
+func SpecHash(spec *monitoringv1.PrometheusRuleSpec) string {
+	// The spec only holds strings, maps and slices, so marshalling can't fail
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// GeneratePrometheusRule creates the PrometheusRule the operator applies for an AlertRule.
+// The owner reference is left to the caller.
+func GeneratePrometheusRule(alertRule *monitoringv1alpha1.AlertRule) *monitoringv1.PrometheusRule {
+	labels := map[string]string{
+		ManagedByLabel: "kneutral-operator",
+		InstanceLabel:  "kneutral",
+		NameLabel:      alertRule.Name,
+	}
+
+	// Merge user-provided labels
+	for k, v := range alertRule.Spec.Labels {
+		labels[k] = v
+	}
+
+	prometheusRule := &monitoringv1.PrometheusRule{
+		// Server-side apply needs the type set on the object
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: monitoringv1.SchemeGroupVersion.String(),
+			Kind:       monitoringv1.PrometheusRuleKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("kneutral-%s", alertRule.Name),
+			Namespace: alertRule.Namespace,
+			Labels:    labels,
+		},
+		Spec: monitoringv1.PrometheusRuleSpec{
+			Groups: []monitoringv1.RuleGroup{},
+		},
+	}
+
+	// Convert AlertGroups to RuleGroups
+	for _, group := range alertRule.Spec.Groups {
+		ruleGroup := monitoringv1.RuleGroup{
+			Name:  group.Name,
+			Rules: []monitoringv1.Rule{},
+		}
+
+		if group.Interval != "" {
+			interval := monitoringv1.Duration(group.Interval)
+			ruleGroup.Interval = &interval
+		}
+
+		// Convert alerting and recording rules
+		for _, rule := range group.Rules {
+			promRule := monitoringv1.Rule{
+				Alert:       rule.Alert,
+				Record:      rule.Record,
+				Expr:        intstr.FromString(rule.Expr),
+				Labels:      rule.Labels,
+				Annotations: rule.Annotations,
+			}
+
+			if rule.For != "" {
+				forDuration := monitoringv1.Duration(rule.For)
+				promRule.For = &forDuration
+			}
+
+			ruleGroup.Rules = append(ruleGroup.Rules, promRule)
+		}
+
+		prometheusRule.Spec.Groups = append(prometheusRule.Spec.Groups, ruleGroup)
+	}
+
+	prometheusRule.Annotations = map[string]string{
+		SpecHashAnnotation: SpecHash(&prometheusRule.Spec),
+	}
+
+	return prometheusRule
+}
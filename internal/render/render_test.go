@@ -0,0 +1,63 @@
+package render
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+func TestGeneratePrometheusRule(t *testing.T) {
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu", Namespace: "monitoring"},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Labels: map[string]string{"team": "platform"},
+			Groups: []monitoringv1alpha1.AlertGroup{{
+				Name:     "cpu.rules",
+				Interval: "30s",
+				Rules: []monitoringv1alpha1.Rule{
+					{Alert: "HighCPU", Expr: "cpu > 80", For: "5m"},
+					{Record: "cpu:avg", Expr: "avg(cpu)"},
+				},
+			}},
+		},
+	}
+
+	prometheusRule := GeneratePrometheusRule(alertRule)
+
+	if prometheusRule.Name != "kneutral-cpu" || prometheusRule.Namespace != "monitoring" {
+		t.Errorf("generated %s/%s, want monitoring/kneutral-cpu", prometheusRule.Namespace, prometheusRule.Name)
+	}
+	if prometheusRule.Labels["team"] != "platform" || prometheusRule.Labels[ManagedByLabel] != "kneutral-operator" {
+		t.Errorf("labels = %v, want the AlertRule's labels and the operator's", prometheusRule.Labels)
+	}
+	group := prometheusRule.Spec.Groups[0]
+	if group.Interval == nil || *group.Interval != "30s" {
+		t.Errorf("interval = %v, want 30s", group.Interval)
+	}
+	if len(group.Rules) != 2 || group.Rules[0].For == nil || *group.Rules[0].For != "5m" || group.Rules[1].For != nil {
+		t.Errorf("rules = %+v, want for set on the alerting rule only", group.Rules)
+	}
+	if got := prometheusRule.Annotations[SpecHashAnnotation]; got != SpecHash(&prometheusRule.Spec) {
+		t.Errorf("%s = %q, want the hash of the generated spec", SpecHashAnnotation, got)
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	alertRule := &monitoringv1alpha1.AlertRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu", Namespace: "monitoring"},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Groups: []monitoringv1alpha1.AlertGroup{{Name: "cpu.rules", Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: "cpu > 80"}}}},
+		},
+	}
+	first := GeneratePrometheusRule(alertRule).Annotations[SpecHashAnnotation]
+	if again := GeneratePrometheusRule(alertRule).Annotations[SpecHashAnnotation]; again != first {
+		t.Errorf("hash changed from %s to %s for the same AlertRule", first, again)
+	}
+
+	alertRule.Spec.Groups[0].Rules[0].Expr = "cpu > 90"
+	if changed := GeneratePrometheusRule(alertRule).Annotations[SpecHashAnnotation]; changed == first {
+		t.Error("hash unchanged after the expression changed")
+	}
+}
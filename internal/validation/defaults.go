@@ -0,0 +1,42 @@
+package validation
+
+import (
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+const (
+	// DefaultSeverity is the severity label set on alerting rules that don't specify one
+	DefaultSeverity = "warning"
+
+	// DefaultGroupInterval is the evaluation interval set on groups that don't specify one
+	DefaultGroupInterval = "1m"
+)
+
+// SetDefaults fills in the drift policy, the default group interval and the default
+// severity label of alerting rules. Recording rules are left untouched since their
+// labels end up on the recorded series.
+func SetDefaults(spec *monitoringv1alpha1.AlertRuleSpec) {
+	if spec.DriftPolicy == "" {
+		spec.DriftPolicy = monitoringv1alpha1.DriftPolicyRevert
+	}
+
+	for i := range spec.Groups {
+		group := &spec.Groups[i]
+		if group.Interval == "" {
+			group.Interval = DefaultGroupInterval
+		}
+
+		for j := range group.Rules {
+			rule := &group.Rules[j]
+			if rule.Alert == "" {
+				continue
+			}
+			if rule.Labels == nil {
+				rule.Labels = map[string]string{}
+			}
+			if rule.Labels["severity"] == "" {
+				rule.Labels["severity"] = DefaultSeverity
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package validation contains the AlertRule validation and defaulting logic shared by
+// the controller, the admission webhooks and the REST API.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// metricNameRE matches valid Prometheus metric names, which recording rules must produce
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// templateDefs are the variables Prometheus makes available to alert templates
+var templateDefs = []string{
+	"{{$labels := .Labels}}",
+	"{{$externalLabels := .ExternalLabels}}",
+	"{{$externalURL := .ExternalURL}}",
+	"{{$value := .Value}}",
+}
+
+// templateFuncs stubs the functions Prometheus registers for alert templates. Parsing
+// only checks that a function exists, so the real implementations (and the promql
+// engine they depend on) aren't needed.
+var templateFuncs = func() template.FuncMap {
+	stub := func(...interface{}) interface{} { return nil }
+	funcs := template.FuncMap{}
+	for _, name := range []string{
+		"query", "first", "label", "value", "strvalue", "args", "reReplaceAll", "safeHtml",
+		"match", "title", "toUpper", "toLower", "graphLink", "tableLink", "sortByLabel",
+		"stripPort", "stripDomain", "humanize", "humanize1024", "humanizeDuration",
+		"humanizePercentage", "humanizeTimestamp", "toTime", "pathPrefix", "externalURL",
+		"parseDuration", "tmpl",
+	} {
+		funcs[name] = stub
+	}
+	return funcs
+}()
+
+// ValidateAlertRuleSpec validates the spec of an AlertRule
+func ValidateAlertRuleSpec(spec *monitoringv1alpha1.AlertRuleSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	groupsPath := field.NewPath("spec", "groups")
+
+	if len(spec.Groups) == 0 {
+		allErrs = append(allErrs, field.Required(groupsPath, "at least one alert group is required"))
+	}
+
+	groupNames := map[string]bool{}
+	for i := range spec.Groups {
+		group := &spec.Groups[i]
+		if group.Name != "" {
+			if groupNames[group.Name] {
+				allErrs = append(allErrs, field.Duplicate(groupsPath.Index(i).Child("name"), group.Name))
+			}
+			groupNames[group.Name] = true
+		}
+		allErrs = append(allErrs, ValidateAlertGroup(group, groupsPath.Index(i))...)
+	}
+
+	switch spec.DriftPolicy {
+	case "", monitoringv1alpha1.DriftPolicyRevert, monitoringv1alpha1.DriftPolicyReport:
+	default:
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("spec", "driftPolicy"), spec.DriftPolicy,
+			[]string{string(monitoringv1alpha1.DriftPolicyRevert), string(monitoringv1alpha1.DriftPolicyReport)}))
+	}
+
+	return allErrs
+}
+
+// ValidateAlertGroup validates a single AlertGroup
+func ValidateAlertGroup(group *monitoringv1alpha1.AlertGroup, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if group.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), "group name is required"))
+	}
+
+	if group.Interval != "" {
+		allErrs = append(allErrs, validateDuration(group.Interval, fldPath.Child("interval"))...)
+	}
+
+	rulesPath := fldPath.Child("rules")
+	alertNames := map[string]bool{}
+	for i := range group.Rules {
+		rule := &group.Rules[i]
+		// Recording rules may legitimately repeat a series name, alerts may not
+		if rule.Alert != "" {
+			if alertNames[rule.Alert] {
+				allErrs = append(allErrs, field.Duplicate(rulesPath.Index(i).Child("alert"), rule.Alert))
+			}
+			alertNames[rule.Alert] = true
+		}
+		allErrs = append(allErrs, ValidateRule(rule, rulesPath.Index(i))...)
+	}
+
+	allErrs = append(allErrs, validateGroupExpressions(group, fldPath)...)
+
+	return allErrs
+}
+
+// ValidateRule validates a single alerting or recording rule. Expressions are
+// checked separately by ValidateExpressions so that errors can name the group.
+func ValidateRule(rule *monitoringv1alpha1.Rule, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch {
+	case rule.Alert == "" && rule.Record == "":
+		allErrs = append(allErrs, field.Required(fldPath, "exactly one of alert or record must be set"))
+	case rule.Alert != "" && rule.Record != "":
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("record"), rule.Record, "exactly one of alert or record must be set"))
+	}
+
+	if rule.Expr == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("expr"), "expression is required"))
+	}
+
+	if rule.For != "" {
+		allErrs = append(allErrs, validateDuration(rule.For, fldPath.Child("for"))...)
+	}
+
+	// Prometheus rejects these fields on recording rules
+	if rule.Record != "" {
+		if !metricNameRE.MatchString(rule.Record) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("record"), rule.Record, "must be a valid metric name"))
+		}
+		if rule.For != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("for"), "not allowed for recording rules"))
+		}
+		if len(rule.Annotations) > 0 {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("annotations"), "not allowed for recording rules"))
+		}
+	}
+
+	if rule.Alert != "" {
+		annotationsPath := fldPath.Child("annotations")
+		for k, v := range rule.Annotations {
+			if err := ValidateTemplate(rule.Alert, v); err != nil {
+				allErrs = append(allErrs, field.Invalid(annotationsPath.Key(k), v, err.Error()))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// FailureReason returns the condition reason for a spec that failed validation:
+// InvalidExpression if any expression fails to parse, InvalidSpec otherwise
+func FailureReason(spec *monitoringv1alpha1.AlertRuleSpec) string {
+	if len(ValidateExpressions(spec)) > 0 {
+		return monitoringv1alpha1.ReasonInvalidExpression
+	}
+	return monitoringv1alpha1.ReasonInvalidSpec
+}
+
+// ValidateExpressions parses every rule expression in the spec with the PromQL parser
+func ValidateExpressions(spec *monitoringv1alpha1.AlertRuleSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	groupsPath := field.NewPath("spec", "groups")
+
+	for i := range spec.Groups {
+		allErrs = append(allErrs, validateGroupExpressions(&spec.Groups[i], groupsPath.Index(i))...)
+	}
+
+	return allErrs
+}
+
+// validateGroupExpressions parses the expressions of a single group, naming the group
+// and rule in each error so they can be located without the field path indices
+func validateGroupExpressions(group *monitoringv1alpha1.AlertGroup, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	rulesPath := fldPath.Child("rules")
+
+	for i, rule := range group.Rules {
+		if rule.Expr == "" {
+			continue
+		}
+		if err := ValidateExpr(rule.Expr); err != nil {
+			// Expressions can span many lines, so the value is omitted from the message
+			allErrs = append(allErrs, field.Invalid(rulesPath.Index(i).Child("expr"), field.OmitValueType{},
+				fmt.Sprintf("group %q, rule %q: %v", group.Name, ruleName(&rule), err)))
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateExpr parses a PromQL expression. The returned error includes the
+// line:column position of the first parse error.
+func ValidateExpr(expr string) error {
+	_, err := parser.ParseExpr(expr)
+	return err
+}
+
+// ValidateTemplate parses an annotation template the same way Prometheus does when
+// loading an alerting rule, with $labels, $value and friends defined
+func ValidateTemplate(alert, text string) error {
+	_, err := template.New("__alert_" + alert).
+		Funcs(templateFuncs).
+		Option("missingkey=zero").
+		Parse(strings.Join(append(templateDefs, text), ""))
+	return err
+}
+
+// validateDuration checks that a duration uses Prometheus duration syntax, which adds
+// d, w and y units to Go's, and is positive
+func validateDuration(value string, fldPath *field.Path) field.ErrorList {
+	d, err := model.ParseDuration(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be a duration such as 30s, 5m, 1h or 1d")}
+	}
+	if d <= 0 {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be greater than zero")}
+	}
+	return nil
+}
+
+// ruleName returns the alert or record name of a rule
+func ruleName(rule *monitoringv1alpha1.Rule) string {
+	if rule.Record != "" {
+		return rule.Record
+	}
+	return rule.Alert
+}
@@ -0,0 +1,351 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// validSpec returns a spec with one alerting and one recording rule that passes validation
+func validSpec() *monitoringv1alpha1.AlertRuleSpec {
+	return &monitoringv1alpha1.AlertRuleSpec{
+		Groups: []monitoringv1alpha1.AlertGroup{{
+			Name:     "cpu.rules",
+			Interval: "30s",
+			Rules: []monitoringv1alpha1.Rule{
+				{
+					Alert:       "HighCPU",
+					Expr:        `instance:cpu:ratio > 0.9`,
+					For:         "5m",
+					Labels:      map[string]string{"severity": "critical"},
+					Annotations: map[string]string{"summary": "CPU on {{ $labels.instance }} is at {{ humanizePercentage $value }}"},
+				},
+				{Record: "instance:cpu:ratio", Expr: `avg by (instance) (rate(cpu_seconds_total{mode!="idle"}[5m]))`},
+			},
+		}},
+	}
+}
+
+// fieldError is the part of a field.Error the tests compare
+type fieldError struct {
+	Type  field.ErrorType
+	Field string
+}
+
+func TestValidateAlertRuleSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(spec *monitoringv1alpha1.AlertRuleSpec)
+		want   []fieldError
+	}{
+		{
+			name:   "valid",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {},
+		},
+		{
+			name:   "no groups",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) { spec.Groups = nil },
+			want:   []fieldError{{field.ErrorTypeRequired, "spec.groups"}},
+		},
+		{
+			name:   "group without a name",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) { spec.Groups[0].Name = "" },
+			want:   []fieldError{{field.ErrorTypeRequired, "spec.groups[0].name"}},
+		},
+		{
+			name: "duplicate group name",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups = append(spec.Groups, spec.Groups[0])
+			},
+			want: []fieldError{{field.ErrorTypeDuplicate, "spec.groups[1].name"}},
+		},
+		{
+			name: "duplicate alert name in a group",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules = append(spec.Groups[0].Rules, spec.Groups[0].Rules[0])
+			},
+			want: []fieldError{{field.ErrorTypeDuplicate, "spec.groups[0].rules[2].alert"}},
+		},
+		{
+			name: "same alert name in different groups",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				group := spec.Groups[0]
+				group.Name = "cpu.rules.2"
+				spec.Groups = append(spec.Groups, group)
+			},
+		},
+		{
+			name: "repeated recording rule",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules = append(spec.Groups[0].Rules, spec.Groups[0].Rules[1])
+			},
+		},
+		{
+			name: "neither alert nor record",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[1].Record = ""
+			},
+			want: []fieldError{{field.ErrorTypeRequired, "spec.groups[0].rules[1]"}},
+		},
+		{
+			name: "both alert and record",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[1].Alert = "CPURatio"
+			},
+			want: []fieldError{{field.ErrorTypeInvalid, "spec.groups[0].rules[1].record"}},
+		},
+		{
+			name: "missing expression",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[0].Expr = ""
+			},
+			want: []fieldError{{field.ErrorTypeRequired, "spec.groups[0].rules[0].expr"}},
+		},
+		{
+			name: "recording rule with an invalid metric name",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[1].Record = "instance-cpu-ratio"
+			},
+			want: []fieldError{{field.ErrorTypeInvalid, "spec.groups[0].rules[1].record"}},
+		},
+		{
+			name: "recording rule with for and annotations",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[1].For = "5m"
+				spec.Groups[0].Rules[1].Annotations = map[string]string{"summary": "CPU ratio"}
+			},
+			want: []fieldError{
+				{field.ErrorTypeForbidden, "spec.groups[0].rules[1].for"},
+				{field.ErrorTypeForbidden, "spec.groups[0].rules[1].annotations"},
+			},
+		},
+		{
+			name: "recording rule with labels",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[1].Labels = map[string]string{"team": "platform"}
+			},
+		},
+		{
+			name: "invalid PromQL",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[1].Expr = "rate(cpu_seconds_total[5m]"
+			},
+			want: []fieldError{{field.ErrorTypeInvalid, "spec.groups[0].rules[1].expr"}},
+		},
+		{
+			name:   "unsupported drift policy",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) { spec.DriftPolicy = "Ignore" },
+			want:   []fieldError{{field.ErrorTypeNotSupported, "spec.driftPolicy"}},
+		},
+		{
+			name: "annotation template that doesn't parse",
+			modify: func(spec *monitoringv1alpha1.AlertRuleSpec) {
+				spec.Groups[0].Rules[0].Annotations["description"] = "{{ $labels.instance"
+			},
+			want: []fieldError{{field.ErrorTypeInvalid, "spec.groups[0].rules[0].annotations[description]"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := validSpec()
+			tt.modify(spec)
+
+			got := []fieldError{}
+			for _, err := range ValidateAlertRuleSpec(spec) {
+				got = append(got, fieldError{err.Type, err.Field})
+			}
+			want := tt.want
+			if want == nil {
+				want = []fieldError{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("errors = %v, want %v", ValidateAlertRuleSpec(spec), want)
+			}
+		})
+	}
+}
+
+func TestValidateDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"30s", true},
+		{"5m", true},
+		{"1h30m", true},
+		{"1d", true},
+		{"1w", true},
+		{"1y", true},
+		{"0s", false},
+		{"-5m", false},
+		{"5", false},
+		{"5 minutes", false},
+		{"1.5h", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			spec := validSpec()
+			spec.Groups[0].Interval = tt.value
+			spec.Groups[0].Rules[0].For = tt.value
+
+			errs := ValidateAlertRuleSpec(spec)
+			if tt.valid && len(errs) > 0 {
+				t.Errorf("errors = %v, want none", errs)
+			}
+			if !tt.valid {
+				want := []fieldError{
+					{field.ErrorTypeInvalid, "spec.groups[0].interval"},
+					{field.ErrorTypeInvalid, "spec.groups[0].rules[0].for"},
+				}
+				got := []fieldError{}
+				for _, err := range errs {
+					got = append(got, fieldError{err.Type, err.Field})
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("errors = %v, want %v", errs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateExpressions(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		// want are substrings of the error detail, none for a valid expression
+		want []string
+	}{
+		{
+			name: "valid",
+			expr: `sum by (job) (rate(http_requests_total{code=~"5.."}[5m])) > 10`,
+		},
+		{
+			name: "unclosed parenthesis",
+			expr: "rate(cpu_seconds_total[5m]",
+			want: []string{`group "cpu.rules"`, `rule "instance:cpu:ratio"`, "1:27: parse error: unclosed left parenthesis"},
+		},
+		{
+			name: "error on a later line",
+			expr: "up\n  and on(job) cpu_seconds_total{",
+			want: []string{"2:33: parse error"},
+		},
+		{
+			name: "missing operand",
+			expr: "cpu_seconds_total >",
+			want: []string{"1:20: parse error: unexpected end of input"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := validSpec()
+			spec.Groups[0].Rules[1].Expr = tt.expr
+
+			errs := ValidateExpressions(spec)
+			if len(tt.want) == 0 {
+				if len(errs) > 0 {
+					t.Errorf("errors = %v, want none", errs)
+				}
+				if reason := FailureReason(spec); reason != monitoringv1alpha1.ReasonInvalidSpec {
+					t.Errorf("FailureReason = %s, want %s", reason, monitoringv1alpha1.ReasonInvalidSpec)
+				}
+				return
+			}
+
+			if len(errs) != 1 || errs[0].Field != "spec.groups[0].rules[1].expr" {
+				t.Fatalf("errors = %v, want one for spec.groups[0].rules[1].expr", errs)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(errs[0].Detail, want) {
+					t.Errorf("detail = %q, want it to contain %q", errs[0].Detail, want)
+				}
+			}
+			if reason := FailureReason(spec); reason != monitoringv1alpha1.ReasonInvalidExpression {
+				t.Errorf("FailureReason = %s, want %s", reason, monitoringv1alpha1.ReasonInvalidExpression)
+			}
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		valid bool
+	}{
+		{"plain text", "CPU is high", true},
+		{"labels and value", "{{ $labels.instance }} is at {{ $value }}", true},
+		{"external labels and URL", "{{ $externalLabels.cluster }}: {{ $externalURL }}", true},
+		{"Prometheus functions", `{{ humanizePercentage $value }} since {{ query "up" | first | value | humanizeTimestamp }}`, true},
+		{"control structures", `{{ if gt $value 0.9 }}critical{{ else }}high{{ end }}`, true},
+		{"unknown function", "{{ nosuchfunc $value }}", false},
+		{"undefined variable", "{{ $instance }}", false},
+		{"unclosed action", "{{ $labels.instance", false},
+		{"unterminated if", "{{ if $value }}high", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplate("HighCPU", tt.text)
+			if tt.valid && err != nil {
+				t.Errorf("err = %v, want none", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("err = nil, want a parse error")
+			}
+		})
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	spec := &monitoringv1alpha1.AlertRuleSpec{
+		Groups: []monitoringv1alpha1.AlertGroup{
+			{
+				Name: "cpu.rules",
+				Rules: []monitoringv1alpha1.Rule{
+					{Alert: "HighCPU", Expr: "cpu > 90"},
+					{Alert: "CriticalCPU", Expr: "cpu > 99", Labels: map[string]string{"severity": "critical"}},
+					{Alert: "EmptySeverity", Expr: "cpu > 95", Labels: map[string]string{"severity": "", "team": "platform"}},
+					{Record: "instance:cpu:ratio", Expr: "avg by (instance) (cpu)"},
+				},
+			},
+			{Name: "load.rules", Interval: "5m", Rules: []monitoringv1alpha1.Rule{{Alert: "HighLoad", Expr: "load > 4"}}},
+		},
+	}
+
+	SetDefaults(spec)
+
+	want := &monitoringv1alpha1.AlertRuleSpec{
+		DriftPolicy: monitoringv1alpha1.DriftPolicyRevert,
+		Groups: []monitoringv1alpha1.AlertGroup{
+			{
+				Name:     "cpu.rules",
+				Interval: DefaultGroupInterval,
+				Rules: []monitoringv1alpha1.Rule{
+					{Alert: "HighCPU", Expr: "cpu > 90", Labels: map[string]string{"severity": DefaultSeverity}},
+					{Alert: "CriticalCPU", Expr: "cpu > 99", Labels: map[string]string{"severity": "critical"}},
+					{Alert: "EmptySeverity", Expr: "cpu > 95", Labels: map[string]string{"severity": DefaultSeverity, "team": "platform"}},
+					{Record: "instance:cpu:ratio", Expr: "avg by (instance) (cpu)"},
+				},
+			},
+			{Name: "load.rules", Interval: "5m", Rules: []monitoringv1alpha1.Rule{{Alert: "HighLoad", Expr: "load > 4", Labels: map[string]string{"severity": DefaultSeverity}}}},
+		},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("defaulted spec = %+v, want %+v", spec, want)
+	}
+
+	// A policy that is already set is kept
+	spec = &monitoringv1alpha1.AlertRuleSpec{DriftPolicy: monitoringv1alpha1.DriftPolicyReport}
+	SetDefaults(spec)
+	if spec.DriftPolicy != monitoringv1alpha1.DriftPolicyReport {
+		t.Errorf("driftPolicy = %s, want %s", spec.DriftPolicy, monitoringv1alpha1.DriftPolicyReport)
+	}
+}
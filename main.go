@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -20,6 +24,9 @@ import (
 	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
 	"github.com/kneutral-org/kneutral-operator/controllers"
 	"github.com/kneutral-org/kneutral-operator/internal/api"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/prometheus"
+	"github.com/kneutral-org/kneutral-operator/webhooks"
 )
 
 var (
@@ -39,6 +46,22 @@ func main() {
 	var probeAddr string
 	var apiAddr string
 	var namespace string
+	var enableWebhooks bool
+	var prometheusURL string
+	var prometheusPollInterval time.Duration
+	var activeAlertsSource string
+	var alertmanagerURL string
+	var apiAuth bool
+	var apiAuthorization bool
+	var apiKeysSecret string
+	var apiTokenAudiences string
+	var apiCORSOrigins string
+	var apiMaxBodyBytes int64
+	var apiTLSCertFile string
+	var apiTLSKeyFile string
+	var apiClientCAFile string
+	var apiRequireClientCert bool
+	var apiTimeouts api.Timeouts
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -47,6 +70,52 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&namespace, "namespace", "", "Namespace to watch for resources (empty for all namespaces)")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the AlertRule defaulting and validating admission webhooks. "+
+			"Requires a serving certificate in the webhook server's cert dir.")
+	flag.StringVar(&prometheusURL, "prometheus-url", "",
+		"Base URL of the Prometheus that loads the generated rules, e.g. http://prometheus-operated.monitoring:9090. "+
+			"When set, rule evaluation health is reported in AlertRule status.")
+	flag.DurationVar(&prometheusPollInterval, "prometheus-poll-interval", time.Minute,
+		"How often to refresh rule evaluation health and active alerts.")
+	flag.StringVar(&activeAlertsSource, "active-alerts-source", "",
+		"Where to read pending and firing alerts from to report counts in AlertRule status: "+
+			"prometheus (uses --prometheus-url), alertmanager (uses --alertmanager-url) or empty to disable.")
+	flag.StringVar(&alertmanagerURL, "alertmanager-url", "",
+		"Base URL of the Alertmanager used by --active-alerts-source=alertmanager, e.g. http://alertmanager-operated.monitoring:9093.")
+	flag.BoolVar(&apiAuth, "api-auth", true,
+		"Require callers of the REST API to authenticate with a Kubernetes bearer token, validated with a TokenReview, "+
+			"or with an API key from --api-keys-secret.")
+	flag.BoolVar(&apiAuthorization, "api-authorization", true,
+		"Check every REST API request against the caller's RBAC permissions on alertrules with a SubjectAccessReview. "+
+			"Requires --api-auth.")
+	flag.StringVar(&apiKeysSecret, "api-keys-secret", "",
+		"Secret, as namespace/name, whose entries map API key names to static API keys accepted when a token fails review.")
+	flag.StringVar(&apiTokenAudiences, "api-token-audiences", "",
+		"Comma separated audiences bearer tokens must be issued for. Empty accepts the API server's default audiences.")
+	flag.StringVar(&apiCORSOrigins, "api-cors-allowed-origins", "",
+		"Comma separated origins, such as https://dashboard.example.com, whose browser pages may call the REST API. "+
+			"\"*\" allows any origin. Empty sends no CORS headers.")
+	flag.Int64Var(&apiMaxBodyBytes, "api-max-request-body-bytes", api.DefaultMaxRequestBodyBytes,
+		"Largest REST API request body read; larger ones are rejected with 413. 0 means no limit.")
+	flag.StringVar(&apiTLSCertFile, "api-tls-cert-file", "",
+		"Serving certificate of the REST API. When set together with --api-tls-key-file the API is served over HTTPS; "+
+			"the files are reloaded when they change.")
+	flag.StringVar(&apiTLSKeyFile, "api-tls-key-file", "", "Private key of the REST API serving certificate.")
+	flag.StringVar(&apiClientCAFile, "api-client-ca-file", "",
+		"CA bundle that REST API client certificates are verified against. Verified client certificates "+
+			"authenticate the caller by common name and organizations.")
+	flag.BoolVar(&apiRequireClientCert, "api-require-client-cert", false,
+		"Reject REST API connections that don't present a client certificate signed by --api-client-ca-file.")
+	flag.DurationVar(&apiTimeouts.Read, "api-read-timeout", api.DefaultTimeouts.Read,
+		"Maximum duration for reading a REST API request, including the body.")
+	flag.DurationVar(&apiTimeouts.Write, "api-write-timeout", api.DefaultTimeouts.Write,
+		"Maximum duration for handling a REST API request and writing the response.")
+	flag.DurationVar(&apiTimeouts.Idle, "api-idle-timeout", api.DefaultTimeouts.Idle,
+		"Maximum duration a keep-alive REST API connection waits for the next request.")
+	flag.DurationVar(&apiTimeouts.Shutdown, "api-shutdown-timeout", api.DefaultTimeouts.Shutdown,
+		"How long in-flight REST API requests may take to finish on shutdown before they are cancelled. "+
+			"Should be shorter than the pod's termination grace period.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -85,15 +154,58 @@ func main() {
 	}
 
 	// Setup AlertRule controller
-	if err = (&controllers.AlertRuleReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AlertRule"),
-	}).SetupWithManager(mgr); err != nil {
+	reconciler := &controllers.AlertRuleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("controllers").WithName("AlertRule"),
+		Recorder: mgr.GetEventRecorderFor("kneutral-operator"),
+	}
+	if prometheusURL != "" {
+		// Cache responses for part of the poll interval so AlertRules share one fetch
+		reconciler.Prometheus = prometheus.NewClient(prometheusURL, prometheusPollInterval/2)
+		setupLog.Info("Reporting rule health from Prometheus", "url", prometheusURL, "interval", prometheusPollInterval)
+	}
+	switch activeAlertsSource {
+	case "":
+	case "prometheus":
+		if reconciler.Prometheus == nil {
+			setupLog.Error(nil, "--active-alerts-source=prometheus requires --prometheus-url")
+			os.Exit(1)
+		}
+		reconciler.Alerts = reconciler.Prometheus
+		setupLog.Info("Reporting active alerts from Prometheus", "url", prometheusURL)
+	case "alertmanager":
+		if alertmanagerURL == "" {
+			setupLog.Error(nil, "--active-alerts-source=alertmanager requires --alertmanager-url")
+			os.Exit(1)
+		}
+		reconciler.Alerts = prometheus.NewAlertmanagerClient(alertmanagerURL, prometheusPollInterval/2)
+		setupLog.Info("Reporting active alerts from Alertmanager", "url", alertmanagerURL)
+	default:
+		setupLog.Error(nil, "invalid --active-alerts-source, must be prometheus or alertmanager", "value", activeAlertsSource)
+		os.Exit(1)
+	}
+	reconciler.PrometheusPollInterval = prometheusPollInterval
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AlertRule")
 		os.Exit(1)
 	}
 
+	// Setup AlertRule admission webhooks
+	if enableWebhooks {
+		if err = (&webhooks.AlertRuleWebhook{
+			Log: ctrl.Log.WithName("webhooks").WithName("AlertRule"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AlertRule")
+			os.Exit(1)
+		}
+	}
+
+	if err := metrics.RegisterAlertRuleCollector(mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register metrics collector")
+		os.Exit(1)
+	}
+
 	// Setup health checks
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -104,15 +216,67 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Start API server in a goroutine
+	// The API server runs with the manager, which stops it on SIGTERM
 	apiServer := api.NewServer(mgr.GetClient(), apiAddr)
-	go func() {
-		setupLog.Info("Starting API server", "address", apiAddr)
-		if err := apiServer.Start(); err != nil {
-			setupLog.Error(err, "problem running API server")
+	apiServer.SetListReader(mgr.GetAPIReader())
+	apiServer.SetEventReader(mgr.GetAPIReader())
+	apiServer.SetTimeouts(apiTimeouts)
+	apiServer.SetMaxRequestBodyBytes(apiMaxBodyBytes)
+	apiServer.SetCORSOrigins(strings.Split(apiCORSOrigins, ","))
+	// Watches are served from the manager's AlertRule informer, which the controller
+	// already runs
+	alertRuleInformer, err := mgr.GetCache().GetInformer(context.Background(), &monitoringv1alpha1.AlertRule{})
+	if err != nil {
+		setupLog.Error(err, "unable to get AlertRule informer")
+		os.Exit(1)
+	}
+	apiServer.SetWatchSource(alertRuleInformer)
+	if apiTLSCertFile != "" || apiTLSKeyFile != "" {
+		if err := apiServer.SetTLS(api.TLSOptions{
+			CertFile:          apiTLSCertFile,
+			KeyFile:           apiTLSKeyFile,
+			ClientCAFile:      apiClientCAFile,
+			RequireClientCert: apiRequireClientCert,
+		}); err != nil {
+			setupLog.Error(err, "invalid REST API TLS configuration")
 			os.Exit(1)
 		}
-	}()
+	} else if apiClientCAFile != "" || apiRequireClientCert {
+		setupLog.Error(nil, "--api-client-ca-file and --api-require-client-cert need --api-tls-cert-file and --api-tls-key-file")
+		os.Exit(1)
+	}
+	if apiAuth {
+		var audiences []string
+		if apiTokenAudiences != "" {
+			audiences = strings.Split(apiTokenAudiences, ",")
+		}
+		var authenticators api.Authenticators
+		if apiClientCAFile != "" {
+			authenticators = append(authenticators, api.ClientCertAuthenticator{})
+		}
+		authenticators = append(authenticators, api.NewTokenReviewAuthenticator(mgr.GetClient(), audiences, time.Minute))
+		if apiKeysSecret != "" {
+			secretNamespace, secretName, found := strings.Cut(apiKeysSecret, "/")
+			if !found {
+				setupLog.Error(nil, "--api-keys-secret must be namespace/name", "value", apiKeysSecret)
+				os.Exit(1)
+			}
+			authenticators = append(authenticators, api.NewAPIKeyAuthenticator(mgr.GetAPIReader(),
+				types.NamespacedName{Namespace: secretNamespace, Name: secretName}, time.Minute))
+		}
+		apiServer.SetAuthenticator(authenticators)
+		if apiAuthorization {
+			apiServer.SetAuthorizer(api.NewSubjectAccessReviewAuthorizer(mgr.GetClient()))
+		} else {
+			setupLog.Info("REST API authorization is disabled, authenticated callers act with the operator's permissions")
+		}
+	} else {
+		setupLog.Info("REST API authentication is disabled")
+	}
+	if err := mgr.Add(apiServer); err != nil {
+		setupLog.Error(err, "unable to add API server to manager")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	setupLog.Info(fmt.Sprintf("Operator endpoints - Metrics: %s, Health: %s, API: %s", metricsAddr, probeAddr, apiAddr))
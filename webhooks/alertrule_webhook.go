@@ -0,0 +1,84 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+	"github.com/kneutral-org/kneutral-operator/internal/metrics"
+	"github.com/kneutral-org/kneutral-operator/internal/validation"
+)
+
+// AlertRuleWebhook defaults and validates AlertRule objects on admission
+type AlertRuleWebhook struct {
+	Log logr.Logger
+}
+
+// +kubebuilder:webhook:path=/mutate-monitoring-kneutral-io-v1alpha1-alertrule,mutating=true,failurePolicy=fail,sideEffects=None,groups=monitoring.kneutral.io,resources=alertrules,verbs=create;update,versions=v1alpha1,name=malertrule.kb.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-monitoring-kneutral-io-v1alpha1-alertrule,mutating=false,failurePolicy=fail,sideEffects=None,groups=monitoring.kneutral.io,resources=alertrules,verbs=create;update,versions=v1alpha1,name=valertrule.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &AlertRuleWebhook{}
+var _ admission.CustomValidator = &AlertRuleWebhook{}
+
+// SetupWithManager registers the defaulting and validating webhooks with the Manager.
+func (w *AlertRuleWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&monitoringv1alpha1.AlertRule{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default sets the default severity label and group interval
+func (w *AlertRuleWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	alertRule, ok := obj.(*monitoringv1alpha1.AlertRule)
+	if !ok {
+		return fmt.Errorf("expected an AlertRule but got %T", obj)
+	}
+
+	validation.SetDefaults(&alertRule.Spec)
+	return nil
+}
+
+// ValidateCreate validates a new AlertRule
+func (w *AlertRuleWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, w.validate(obj)
+}
+
+// ValidateUpdate validates an updated AlertRule
+func (w *AlertRuleWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	// The controller removes its finalizer with an update, which must not be blocked
+	// by a spec that was stored before the webhook was enabled
+	if alertRule, ok := newObj.(*monitoringv1alpha1.AlertRule); ok && !alertRule.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return nil, w.validate(newObj)
+}
+
+// ValidateDelete allows every delete so that broken AlertRules can always be removed
+func (w *AlertRuleWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate runs the same checks as the REST API and rejects the object if any fail
+func (w *AlertRuleWebhook) validate(obj runtime.Object) error {
+	alertRule, ok := obj.(*monitoringv1alpha1.AlertRule)
+	if !ok {
+		return fmt.Errorf("expected an AlertRule but got %T", obj)
+	}
+
+	errs := validation.ValidateAlertRuleSpec(&alertRule.Spec)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	metrics.ValidationFailuresTotal.WithLabelValues(validation.FailureReason(&alertRule.Spec), metrics.SourceWebhook).Inc()
+	w.Log.Info("Rejected invalid AlertRule", "namespace", alertRule.Namespace, "name", alertRule.Name, "errors", errs.ToAggregate().Error())
+	return apierrors.NewInvalid(monitoringv1alpha1.GroupVersion.WithKind("AlertRule").GroupKind(), alertRule.Name, errs)
+}
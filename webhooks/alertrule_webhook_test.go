@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1alpha1 "github.com/kneutral-org/kneutral-operator/api/v1alpha1"
+)
+
+// admissionRequest returns the admission request the API server sends for operation on
+// alertRule, with old as the stored object for updates
+func admissionRequest(t *testing.T, operation admissionv1.Operation, alertRule, old *monitoringv1alpha1.AlertRule) admission.Request {
+	t.Helper()
+	encode := func(obj *monitoringv1alpha1.AlertRule) runtime.RawExtension {
+		if obj == nil {
+			return runtime.RawExtension{}
+		}
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: raw}
+	}
+	request := admissionv1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind(monitoringv1alpha1.GroupVersion.WithKind("AlertRule")),
+		Namespace: alertRule.Namespace,
+		Name:      alertRule.Name,
+		Operation: operation,
+		Object:    encode(alertRule),
+		OldObject: encode(old),
+	}
+	if operation == admissionv1.Delete {
+		request.Object, request.OldObject = runtime.RawExtension{}, encode(alertRule)
+	}
+	return admission.Request{AdmissionRequest: request}
+}
+
+// webhookAlertRule returns an AlertRule with one alerting rule using expr
+func webhookAlertRule(expr string) *monitoringv1alpha1.AlertRule {
+	return &monitoringv1alpha1.AlertRule{
+		TypeMeta:   metav1.TypeMeta{APIVersion: monitoringv1alpha1.GroupVersion.String(), Kind: "AlertRule"},
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu", Namespace: "monitoring"},
+		Spec: monitoringv1alpha1.AlertRuleSpec{
+			Groups: []monitoringv1alpha1.AlertGroup{{
+				Name:  "cpu.rules",
+				Rules: []monitoringv1alpha1.Rule{{Alert: "HighCPU", Expr: expr, For: "5m"}},
+			}},
+		},
+	}
+}
+
+func TestValidatingWebhook(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	webhook := admission.WithCustomValidator(scheme, &monitoringv1alpha1.AlertRule{}, &AlertRuleWebhook{Log: logr.Discard()})
+
+	deleting := webhookAlertRule("cpu >")
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	deleting.Finalizers = []string{"alertrule.kneutral.io/finalizer"}
+
+	tests := []struct {
+		name      string
+		request   admission.Request
+		allowed   bool
+		wantCause string
+	}{
+		{
+			name:    "valid create",
+			request: admissionRequest(t, admissionv1.Create, webhookAlertRule("cpu > 90"), nil),
+			allowed: true,
+		},
+		{
+			name:      "invalid create",
+			request:   admissionRequest(t, admissionv1.Create, webhookAlertRule("cpu >"), nil),
+			wantCause: "spec.groups[0].rules[0].expr",
+		},
+		{
+			name:      "invalid update",
+			request:   admissionRequest(t, admissionv1.Update, webhookAlertRule("rate(cpu[5m]"), webhookAlertRule("cpu > 90")),
+			wantCause: "spec.groups[0].rules[0].expr",
+		},
+		{
+			name:    "finalizer removal of an invalid AlertRule being deleted",
+			request: admissionRequest(t, admissionv1.Update, deleting, deleting),
+			allowed: true,
+		},
+		{
+			name:    "delete of an invalid AlertRule",
+			request: admissionRequest(t, admissionv1.Delete, webhookAlertRule("cpu >"), nil),
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := webhook.Handle(context.Background(), tt.request)
+			if response.Allowed != tt.allowed {
+				t.Fatalf("allowed = %v (%+v), want %v", response.Allowed, response.Result, tt.allowed)
+			}
+			if tt.allowed {
+				return
+			}
+			if response.Result.Code != http.StatusUnprocessableEntity || response.Result.Reason != metav1.StatusReasonInvalid {
+				t.Errorf("result = %d %s, want 422 Invalid", response.Result.Code, response.Result.Reason)
+			}
+			if !strings.Contains(response.Result.Message, tt.wantCause) {
+				t.Errorf("message = %q, want it to name %s", response.Result.Message, tt.wantCause)
+			}
+		})
+	}
+}
+
+func TestDefaultingWebhook(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	webhook := admission.WithCustomDefaulter(scheme, &monitoringv1alpha1.AlertRule{}, &AlertRuleWebhook{Log: logr.Discard()})
+
+	response := webhook.Handle(context.Background(), admissionRequest(t, admissionv1.Create, webhookAlertRule("cpu > 90"), nil))
+	if !response.Allowed {
+		t.Fatalf("defaulting denied: %+v", response.Result)
+	}
+
+	patched := map[string]string{}
+	for _, op := range response.Patches {
+		value, _ := json.Marshal(op.Value)
+		patched[op.Path] = string(value)
+	}
+	want := map[string]string{
+		"/spec/driftPolicy":             `"Revert"`,
+		"/spec/groups/0/interval":       `"1m"`,
+		"/spec/groups/0/rules/0/labels": `{"severity":"warning"}`,
+	}
+	for path, value := range want {
+		if patched[path] != value {
+			t.Errorf("patch of %s = %s, want %s (patches %v)", path, patched[path], value, patched)
+		}
+	}
+}